@@ -0,0 +1,646 @@
+package hub
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/cozy-creator/hf-hub/hub/utils"
+	"github.com/gofrs/flock"
+)
+
+// CacheInfo is the content of a cache directory, as returned by ScanCache.
+type CacheInfo struct {
+	// SizeOnDisk is the sum of the blob sizes of every repo. Blobs shared by several revisions are counted once.
+	SizeOnDisk int64
+	Repos      []*CachedRepoInfo
+	// Warnings lists the entries of the cache that couldn't be scanned, as *CorruptedCacheError.
+	Warnings []error
+}
+
+type CachedRepoInfo struct {
+	RepoId   string
+	RepoType string
+	RepoPath string
+	// SizeOnDisk is the sum of the sizes of the blobs used by the revisions of the repo.
+	SizeOnDisk int64
+	// NbFiles is the number of blobs used by the revisions of the repo.
+	NbFiles   int
+	Revisions []*CachedRevisionInfo
+	// LastAccessed and LastModified are the most recent access and modification times of the blobs of the repo.
+	LastAccessed time.Time
+	LastModified time.Time
+}
+
+type CachedRevisionInfo struct {
+	CommitHash   string
+	SnapshotPath string
+	// SizeOnDisk is the sum of the sizes of the blobs used by this revision, which may be shared with other revisions.
+	SizeOnDisk int64
+	Files      []*CachedFileInfo
+	// Refs are the branches and tags (e.g. "main" or "refs/pr/1") pointing to this revision.
+	Refs         []string
+	LastModified time.Time
+}
+
+type CachedFileInfo struct {
+	// FileName is the path of the file in the repo, e.g. "vae/config.json".
+	FileName string
+	// FilePath is the path of the file in the snapshot folder, usually a symlink to BlobPath.
+	FilePath         string
+	BlobPath         string
+	SizeOnDisk       int64
+	BlobLastAccessed time.Time
+	BlobLastModified time.Time
+}
+
+// CorruptedCacheError describes an entry of the cache that doesn't follow the expected layout.
+type CorruptedCacheError struct {
+	Path    string
+	Message string
+}
+
+func (e *CorruptedCacheError) Error() string {
+	return fmt.Sprintf("corrupted cache entry %s: %s", e.Path, e.Message)
+}
+
+// filesToIgnore are created by the OS and are not part of the cache.
+var filesToIgnore = []string{".DS_Store"}
+
+type blobStat struct {
+	size         int64
+	lastAccessed time.Time
+	lastModified time.Time
+}
+
+// ScanCache scans a cache directory and returns the repos, revisions and files it contains.
+// Repos that can't be scanned are reported in the warnings of the result instead of failing the whole scan.
+// Port of `scan_cache_dir` from the python package.
+func ScanCache(cacheDir string) (*CacheInfo, error) {
+	cacheDir, err := expandPath(cacheDir)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := os.Stat(cacheDir)
+	if err != nil {
+		return nil, fmt.Errorf("cache directory not found: %w", err)
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("scan cache expects a directory but found a file: %s", cacheDir)
+	}
+
+	entries, err := os.ReadDir(cacheDir)
+	if err != nil {
+		return nil, err
+	}
+
+	cacheInfo := &CacheInfo{}
+	for _, entry := range entries {
+		if entry.Name() == ".locks" {
+			continue
+		}
+
+		repo, err := scanCachedRepo(filepath.Join(cacheDir, entry.Name()))
+		if err != nil {
+			var corruptedErr *CorruptedCacheError
+			if errors.As(err, &corruptedErr) {
+				cacheInfo.Warnings = append(cacheInfo.Warnings, err)
+				continue
+			}
+			return nil, err
+		}
+
+		cacheInfo.Repos = append(cacheInfo.Repos, repo)
+		cacheInfo.SizeOnDisk += repo.SizeOnDisk
+	}
+
+	return cacheInfo, nil
+}
+
+func (client *Client) ScanCache() (*CacheInfo, error) {
+	return ScanCache(client.CacheDir)
+}
+
+// Refs maps the refs of the repo (e.g. "main") to the cached revision they point to.
+func (repo *CachedRepoInfo) Refs() map[string]*CachedRevisionInfo {
+	refs := make(map[string]*CachedRevisionInfo)
+	for _, revision := range repo.Revisions {
+		for _, ref := range revision.Refs {
+			refs[ref] = revision
+		}
+	}
+	return refs
+}
+
+func scanCachedRepo(repoPath string) (*CachedRepoInfo, error) {
+	corrupted := func(message string, args ...any) error {
+		return &CorruptedCacheError{Path: repoPath, Message: fmt.Sprintf(message, args...)}
+	}
+
+	repoInfo, err := os.Stat(repoPath)
+	if err != nil {
+		return nil, err
+	}
+	if !repoInfo.IsDir() {
+		return nil, corrupted("repo path is not a directory")
+	}
+
+	repoType, repoId, found := strings.Cut(filepath.Base(repoPath), "--")
+	if !found {
+		return nil, corrupted("repo path is not a valid HuggingFace cache directory")
+	}
+	repoType = strings.TrimSuffix(repoType, "s")
+	repoId = strings.ReplaceAll(repoId, "--", "/")
+	if !isValidRepoType(repoType) {
+		return nil, corrupted("repo type must be `dataset`, `model` or `space`, found `%s`", repoType)
+	}
+
+	snapshotsPath := filepath.Join(repoPath, "snapshots")
+	refsPath := filepath.Join(repoPath, "refs")
+
+	snapshotsInfo, err := os.Stat(snapshotsPath)
+	if err != nil || !snapshotsInfo.IsDir() {
+		return nil, corrupted("snapshots dir doesn't exist in cached repo")
+	}
+
+	// Scan the refs first, to attach them to the revisions
+	refsByHash := make(map[string][]string)
+	refsInfo, err := os.Stat(refsPath)
+	if err == nil {
+		if !refsInfo.IsDir() {
+			return nil, corrupted("refs is defined as a file")
+		}
+
+		err := filepath.WalkDir(refsPath, func(path string, entry fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if entry.IsDir() || isIgnoredCacheFile(entry.Name()) {
+				return nil
+			}
+
+			refName, err := filepath.Rel(refsPath, path)
+			if err != nil {
+				return err
+			}
+			commitHash, err := os.ReadFile(path)
+			if err != nil {
+				return err
+			}
+
+			refsByHash[string(commitHash)] = append(refsByHash[string(commitHash)], filepath.ToSlash(refName))
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	revisionEntries, err := os.ReadDir(snapshotsPath)
+	if err != nil {
+		return nil, err
+	}
+
+	blobStats := make(map[string]*blobStat)
+	var revisions []*CachedRevisionInfo
+	for _, revisionEntry := range revisionEntries {
+		if isIgnoredCacheFile(revisionEntry.Name()) {
+			continue
+		}
+		if !revisionEntry.IsDir() {
+			return nil, corrupted("snapshots folder contains a file: %s", revisionEntry.Name())
+		}
+
+		revision, err := scanCachedRevision(filepath.Join(snapshotsPath, revisionEntry.Name()), blobStats)
+		if err != nil {
+			return nil, err
+		}
+
+		revision.Refs = refsByHash[revision.CommitHash]
+		sort.Strings(revision.Refs)
+		delete(refsByHash, revision.CommitHash)
+
+		revisions = append(revisions, revision)
+	}
+
+	if len(refsByHash) > 0 {
+		missingHashes := make([]string, 0, len(refsByHash))
+		for commitHash := range refsByHash {
+			missingHashes = append(missingHashes, commitHash)
+		}
+		sort.Strings(missingHashes)
+		return nil, corrupted("reference(s) refer to missing commit hashes: %s", strings.Join(missingHashes, ", "))
+	}
+
+	sort.Slice(revisions, func(i, j int) bool {
+		return revisions[i].CommitHash < revisions[j].CommitHash
+	})
+
+	cachedRepo := &CachedRepoInfo{
+		RepoId:    repoId,
+		RepoType:  repoType,
+		RepoPath:  repoPath,
+		NbFiles:   len(blobStats),
+		Revisions: revisions,
+	}
+
+	for _, stat := range blobStats {
+		cachedRepo.SizeOnDisk += stat.size
+		if stat.lastAccessed.After(cachedRepo.LastAccessed) {
+			cachedRepo.LastAccessed = stat.lastAccessed
+		}
+		if stat.lastModified.After(cachedRepo.LastModified) {
+			cachedRepo.LastModified = stat.lastModified
+		}
+	}
+
+	if len(blobStats) == 0 {
+		cachedRepo.LastModified = repoInfo.ModTime()
+		cachedRepo.LastAccessed, err = utils.GetAccessTime(repoPath)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return cachedRepo, nil
+}
+
+// scanCachedRevision scans a snapshot folder, and records the stats of the blobs it points to in blobStats.
+func scanCachedRevision(snapshotPath string, blobStats map[string]*blobStat) (*CachedRevisionInfo, error) {
+	revision := &CachedRevisionInfo{
+		CommitHash:   filepath.Base(snapshotPath),
+		SnapshotPath: snapshotPath,
+	}
+
+	revisionBlobs := make(map[string]bool)
+	err := filepath.WalkDir(snapshotPath, func(filePath string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() {
+			return nil
+		}
+
+		blobPath, err := filepath.EvalSymlinks(filePath)
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				return &CorruptedCacheError{Path: filePath, Message: "blob missing (broken symlink)"}
+			}
+			return err
+		}
+
+		stat, ok := blobStats[blobPath]
+		if !ok {
+			blobInfo, err := os.Stat(blobPath)
+			if err != nil {
+				return err
+			}
+			lastAccessed, err := utils.GetAccessTime(blobPath)
+			if err != nil {
+				return err
+			}
+
+			stat = &blobStat{
+				size:         blobInfo.Size(),
+				lastAccessed: lastAccessed,
+				lastModified: blobInfo.ModTime(),
+			}
+			blobStats[blobPath] = stat
+		}
+
+		fileName, err := filepath.Rel(snapshotPath, filePath)
+		if err != nil {
+			return err
+		}
+
+		revision.Files = append(revision.Files, &CachedFileInfo{
+			FileName:         filepath.ToSlash(fileName),
+			FilePath:         filePath,
+			BlobPath:         blobPath,
+			SizeOnDisk:       stat.size,
+			BlobLastAccessed: stat.lastAccessed,
+			BlobLastModified: stat.lastModified,
+		})
+
+		if !revisionBlobs[blobPath] {
+			revisionBlobs[blobPath] = true
+			revision.SizeOnDisk += stat.size
+		}
+		if stat.lastModified.After(revision.LastModified) {
+			revision.LastModified = stat.lastModified
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if len(revision.Files) == 0 {
+		snapshotInfo, err := os.Stat(snapshotPath)
+		if err != nil {
+			return nil, err
+		}
+		revision.LastModified = snapshotInfo.ModTime()
+	}
+
+	return revision, nil
+}
+
+func isIgnoredCacheFile(name string) bool {
+	for _, ignored := range filesToIgnore {
+		if name == ignored {
+			return true
+		}
+	}
+	return false
+}
+
+// DeleteCacheStrategy lists the paths to delete to free some revisions from the cache.
+// It is computed by CacheInfo.DeleteRevisions and nothing is deleted until Execute is called.
+type DeleteCacheStrategy struct {
+	// ExpectedFreedSize is the number of bytes freed by Execute.
+	ExpectedFreedSize int64
+	Blobs             []string
+	Refs              []string
+	Repos             []string
+	Snapshots         []string
+	// MissingRevisions are the requested commit hashes that aren't in the cache, and are thus ignored.
+	MissingRevisions []string
+}
+
+// DeleteRevisions computes the strategy to delete the given revisions (commit hashes) from the cache.
+// Blobs still used by a revision that is kept are not deleted, and a repo whose revisions are all
+// deleted is removed entirely. Port of `HFCacheInfo.delete_revisions` from the python package.
+func (info *CacheInfo) DeleteRevisions(revisions ...string) *DeleteCacheStrategy {
+	hashesToDelete := make(map[string]bool, len(revisions))
+	for _, revision := range revisions {
+		hashesToDelete[revision] = true
+	}
+
+	strategy := &DeleteCacheStrategy{}
+	deletedBlobs := make(map[string]bool)
+
+	for _, repo := range info.Repos {
+		var revisionsToDelete, otherRevisions []*CachedRevisionInfo
+		for _, revision := range repo.Revisions {
+			if hashesToDelete[revision.CommitHash] {
+				revisionsToDelete = append(revisionsToDelete, revision)
+				delete(hashesToDelete, revision.CommitHash)
+			} else {
+				otherRevisions = append(otherRevisions, revision)
+			}
+		}
+
+		if len(revisionsToDelete) == 0 {
+			continue
+		}
+
+		// If no other revisions, it means all revisions are deleted -> delete the entire cached repo
+		if len(otherRevisions) == 0 {
+			strategy.Repos = append(strategy.Repos, repo.RepoPath)
+			strategy.ExpectedFreedSize += repo.SizeOnDisk
+			continue
+		}
+
+		// Some revisions of the repo are deleted but not all, so only the blobs that are not used anymore are deleted
+		keptBlobs := make(map[string]bool)
+		for _, revision := range otherRevisions {
+			for _, file := range revision.Files {
+				keptBlobs[file.BlobPath] = true
+			}
+		}
+
+		for _, revision := range revisionsToDelete {
+			strategy.Snapshots = append(strategy.Snapshots, revision.SnapshotPath)
+			for _, ref := range revision.Refs {
+				strategy.Refs = append(strategy.Refs, filepath.Join(repo.RepoPath, "refs", filepath.FromSlash(ref)))
+			}
+
+			for _, file := range revision.Files {
+				if keptBlobs[file.BlobPath] || deletedBlobs[file.BlobPath] {
+					continue
+				}
+
+				deletedBlobs[file.BlobPath] = true
+				strategy.Blobs = append(strategy.Blobs, file.BlobPath)
+				strategy.ExpectedFreedSize += file.SizeOnDisk
+			}
+		}
+	}
+
+	for revision := range hashesToDelete {
+		strategy.MissingRevisions = append(strategy.MissingRevisions, revision)
+	}
+	sort.Strings(strategy.MissingRevisions)
+
+	return strategy
+}
+
+// Execute deletes the paths of the strategy. It keeps going when a path can't be deleted,
+// and returns the errors of every failed deletion. Paths that are already gone are not errors.
+func (strategy *DeleteCacheStrategy) Execute() error {
+	var errs []error
+
+	deletePaths := func(paths []string, pathType string) {
+		for _, path := range paths {
+			if err := os.RemoveAll(path); err != nil {
+				errs = append(errs, fmt.Errorf("couldn't delete %s %s: %w", pathType, path, err))
+			}
+		}
+	}
+
+	// Blobs are deleted last, so that an interrupted execution never leaves a snapshot pointing to a missing blob
+	deletePaths(strategy.Repos, "repo")
+	deletePaths(strategy.Snapshots, "snapshot")
+	deletePaths(strategy.Refs, "ref")
+	deletePaths(strategy.Blobs, "blob")
+
+	return errors.Join(errs...)
+}
+
+// PruneCache evicts the least recently used revisions of the cache until its size is at most maxSize bytes,
+// and returns the number of bytes freed. Revisions whose blobs are locked by a download in progress (in this
+// or another process) are never evicted, so the size may stay above maxSize.
+func PruneCache(cacheDir string, maxSize int64) (int64, error) {
+	info, err := ScanCache(cacheDir)
+	if err != nil {
+		return 0, err
+	}
+
+	return pruneCache(info, maxSize, nil)
+}
+
+func (client *Client) PruneCache(maxSize int64) (int64, error) {
+	return PruneCache(client.CacheDir, maxSize)
+}
+
+// cachedRevisionKey identifies a revision of the cache by the folder of its repo (e.g. `models--org--repo`) and its
+// commit hash.
+type cachedRevisionKey struct {
+	repoFolderName string
+	commitHash     string
+}
+
+// makeRoomInCache prunes the cache so that size more bytes fit in Client.MaxCacheSize, and on the disk when it is too
+// full, without evicting the revision being downloaded into. It is only called for downloads to the cache, so that
+// other folders don't evict it. Pruning scans the whole cache, so it is serialized to keep concurrent downloads from
+// scanning and evicting it at the same time.
+func (client *Client) makeRoomInCache(size int64, downloading *cachedRevisionKey) {
+	if client.MaxCacheSize <= 0 {
+		return
+	}
+
+	cachePruneLock.Lock()
+	defer cachePruneLock.Unlock()
+
+	cacheDir, err := expandPath(client.CacheDir)
+	if err != nil {
+		log.Printf("failed to prune the cache: %s\n", err)
+		return
+	}
+
+	info, err := ScanCache(cacheDir)
+	if err == nil {
+		maxSize := client.MaxCacheSize - size
+		// Evict cached revisions rather than failing when the disk is full
+		if available, diskErr := utils.GetAvailableDiskSpace(cacheDir); diskErr == nil && available < uint64(size) {
+			maxSize = min(maxSize, info.SizeOnDisk-(size-int64(available)))
+		}
+
+		_, err = pruneCache(info, maxSize, downloading)
+	}
+	if err != nil {
+		log.Printf("failed to prune the cache: %s\n", err)
+	}
+}
+
+// pruneCache evicts the least recently used revisions until the cache fits in maxSize bytes. The downloading
+// revision is never evicted, nor is its repo deleted as a whole, since the download writes into them.
+func pruneCache(info *CacheInfo, maxSize int64, downloading *cachedRevisionKey) (int64, error) {
+	if info.SizeOnDisk <= maxSize {
+		return 0, nil
+	}
+
+	type evictionCandidate struct {
+		repo         *CachedRepoInfo
+		revision     *CachedRevisionInfo
+		lastAccessed time.Time
+	}
+
+	var candidates []evictionCandidate
+	for _, repo := range info.Repos {
+		for _, revision := range repo.Revisions {
+			if downloading != nil && filepath.Base(repo.RepoPath) == downloading.repoFolderName && revision.CommitHash == downloading.commitHash {
+				continue
+			}
+
+			lastAccessed := revision.LastModified
+			for _, file := range revision.Files {
+				if file.BlobLastAccessed.After(lastAccessed) {
+					lastAccessed = file.BlobLastAccessed
+				}
+			}
+			candidates = append(candidates, evictionCandidate{repo, revision, lastAccessed})
+		}
+	}
+
+	sort.Slice(candidates, func(i, j int) bool {
+		return candidates[i].lastAccessed.Before(candidates[j].lastAccessed)
+	})
+
+	// The locks are held until the strategy is executed, so that no download starts on an evicted blob meanwhile
+	var locks []*flock.Flock
+	defer func() {
+		for _, lock := range locks {
+			lock.Unlock()
+		}
+	}()
+
+	var (
+		strategy         *DeleteCacheStrategy
+		evictedRevisions = make(map[*CachedRepoInfo][]string)
+	)
+	for _, candidate := range candidates {
+		lastRevision := len(evictedRevisions[candidate.repo])+1 == len(candidate.repo.Revisions)
+		if lastRevision && downloading != nil && filepath.Base(candidate.repo.RepoPath) == downloading.repoFolderName {
+			continue
+		}
+
+		var lockPaths []string
+		if lastRevision {
+			// The whole repo is deleted with its last revision, including the blobs of the downloads in progress
+			lockPaths, _ = filepath.Glob(filepath.Join(candidate.repo.RepoPath, ".locks", "*.lock"))
+		} else {
+			for _, file := range candidate.revision.Files {
+				lockPaths = append(lockPaths, filepath.Join(candidate.repo.RepoPath, ".locks", filepath.Base(file.BlobPath)+".lock"))
+			}
+		}
+
+		revisionLocks, ok := tryLockAll(lockPaths)
+		if !ok {
+			continue
+		}
+		locks = append(locks, revisionLocks...)
+
+		evictedRevisions[candidate.repo] = append(evictedRevisions[candidate.repo], candidate.revision.CommitHash)
+		strategy = deleteRepoRevisions(evictedRevisions)
+		if info.SizeOnDisk-strategy.ExpectedFreedSize <= maxSize {
+			break
+		}
+	}
+
+	if strategy == nil {
+		return 0, nil
+	}
+
+	return strategy.ExpectedFreedSize, strategy.Execute()
+}
+
+// deleteRepoRevisions computes the strategy to delete the given revisions of each repo. Unlike
+// CacheInfo.DeleteRevisions, a commit hash only matches the revision of its own repo, since forks share commits.
+func deleteRepoRevisions(revisions map[*CachedRepoInfo][]string) *DeleteCacheStrategy {
+	strategy := &DeleteCacheStrategy{}
+	for repo, commitHashes := range revisions {
+		repoStrategy := (&CacheInfo{Repos: []*CachedRepoInfo{repo}}).DeleteRevisions(commitHashes...)
+		strategy.ExpectedFreedSize += repoStrategy.ExpectedFreedSize
+		strategy.Blobs = append(strategy.Blobs, repoStrategy.Blobs...)
+		strategy.Refs = append(strategy.Refs, repoStrategy.Refs...)
+		strategy.Repos = append(strategy.Repos, repoStrategy.Repos...)
+		strategy.Snapshots = append(strategy.Snapshots, repoStrategy.Snapshots...)
+	}
+
+	return strategy
+}
+
+// tryLockAll takes every lock without waiting. If one of them is already held, the ones
+// taken so far are released and false is returned. Missing lock folders count as free locks.
+func tryLockAll(lockPaths []string) ([]*flock.Flock, bool) {
+	var locks []*flock.Flock
+	for _, lockPath := range lockPaths {
+		lock := flock.New(lockPath)
+		locked, err := lock.TryLock()
+		if err != nil && errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+
+		if err != nil || !locked {
+			for _, lock := range locks {
+				lock.Unlock()
+			}
+			return nil, false
+		}
+		locks = append(locks, lock)
+	}
+
+	return locks, true
+}
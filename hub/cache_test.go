@@ -0,0 +1,322 @@
+package hub
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofrs/flock"
+)
+
+var (
+	commitA = strings.Repeat("a", 40)
+	commitB = strings.Repeat("b", 40)
+)
+
+// writeCachedFile writes a file to a revision of a cached repo the way downloads do, as a symlink to its blob,
+// and sets the access and modification times of the blob to lastUsed. It returns the path of the blob.
+func writeCachedFile(t *testing.T, repoPath, commitHash, fileName, content string, lastUsed time.Time) string {
+	t.Helper()
+
+	sum := sha256.Sum256([]byte(content))
+	blobPath := filepath.Join(repoPath, "blobs", hex.EncodeToString(sum[:]))
+	filePath := filepath.Join(repoPath, "snapshots", commitHash, filepath.FromSlash(fileName))
+
+	for _, dir := range []string{filepath.Dir(blobPath), filepath.Dir(filePath)} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(blobPath, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(blobPath, lastUsed, lastUsed); err != nil {
+		t.Fatal(err)
+	}
+
+	relativePath, err := filepath.Rel(filepath.Dir(filePath), blobPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(relativePath, filePath); err != nil {
+		t.Fatal(err)
+	}
+
+	return blobPath
+}
+
+func writeCachedRef(t *testing.T, repoPath, ref, commitHash string) {
+	t.Helper()
+
+	if err := cacheCommitHashForSpecificRevision(repoPath, ref, commitHash); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func scanTestCache(t *testing.T, cacheDir string) *CacheInfo {
+	t.Helper()
+
+	info, err := ScanCache(cacheDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(info.Warnings) > 0 {
+		t.Fatalf("unexpected warnings: %v", info.Warnings)
+	}
+	return info
+}
+
+func assertExists(t *testing.T, path string, want bool) {
+	t.Helper()
+
+	_, err := os.Lstat(path)
+	if exists := err == nil; exists != want {
+		t.Errorf("%s exists = %v, want %v", path, exists, want)
+	}
+}
+
+func TestDeleteRevisionsKeepsSharedBlobs(t *testing.T) {
+	cacheDir := t.TempDir()
+	repoPath := filepath.Join(cacheDir, "models--org--repo")
+	now := time.Now()
+
+	sharedBlob := writeCachedFile(t, repoPath, commitA, "config.json", "shared", now)
+	deletedBlob := writeCachedFile(t, repoPath, commitA, "model.bin", "aaaa", now)
+	writeCachedFile(t, repoPath, commitB, "config.json", "shared", now)
+	keptBlob := writeCachedFile(t, repoPath, commitB, "unet/model.bin", "bb", now)
+	writeCachedRef(t, repoPath, "v1", commitA)
+	writeCachedRef(t, repoPath, "main", commitB)
+
+	info := scanTestCache(t, cacheDir)
+	if info.SizeOnDisk != 12 {
+		t.Fatalf("SizeOnDisk = %d, want 12", info.SizeOnDisk)
+	}
+
+	strategy := info.DeleteRevisions(commitA)
+	if strategy.ExpectedFreedSize != 4 {
+		t.Errorf("ExpectedFreedSize = %d, want 4", strategy.ExpectedFreedSize)
+	}
+	if len(strategy.Repos) != 0 {
+		t.Errorf("Repos = %v, want none", strategy.Repos)
+	}
+	if len(strategy.Blobs) != 1 || strategy.Blobs[0] != deletedBlob {
+		t.Errorf("Blobs = %v, want [%s]", strategy.Blobs, deletedBlob)
+	}
+
+	if err := strategy.Execute(); err != nil {
+		t.Fatal(err)
+	}
+
+	assertExists(t, filepath.Join(repoPath, "snapshots", commitA), false)
+	assertExists(t, filepath.Join(repoPath, "refs", "v1"), false)
+	assertExists(t, deletedBlob, false)
+	assertExists(t, sharedBlob, true)
+	assertExists(t, keptBlob, true)
+	assertExists(t, filepath.Join(repoPath, "refs", "main"), true)
+
+	info = scanTestCache(t, cacheDir)
+	if len(info.Repos) != 1 || len(info.Repos[0].Revisions) != 1 || info.Repos[0].Revisions[0].CommitHash != commitB {
+		t.Fatalf("only %s should be left in the cache", commitB)
+	}
+	if info.SizeOnDisk != 8 {
+		t.Errorf("SizeOnDisk = %d, want 8", info.SizeOnDisk)
+	}
+}
+
+func TestDeleteRevisionsDeletesWholeRepo(t *testing.T) {
+	cacheDir := t.TempDir()
+	repoPath := filepath.Join(cacheDir, "models--org--repo")
+	otherRepoPath := filepath.Join(cacheDir, "datasets--org--data")
+	now := time.Now()
+
+	writeCachedFile(t, repoPath, commitA, "config.json", "shared", now)
+	writeCachedFile(t, repoPath, commitB, "config.json", "shared", now)
+	writeCachedFile(t, repoPath, commitB, "model.bin", "bb", now)
+	writeCachedRef(t, repoPath, "main", commitB)
+	writeCachedFile(t, otherRepoPath, strings.Repeat("d", 40), "data.csv", "csv", now)
+
+	info := scanTestCache(t, cacheDir)
+	missingRevision := strings.Repeat("c", 40)
+	strategy := info.DeleteRevisions(commitA, commitB, missingRevision)
+
+	if strategy.ExpectedFreedSize != 8 {
+		t.Errorf("ExpectedFreedSize = %d, want 8", strategy.ExpectedFreedSize)
+	}
+	if len(strategy.Repos) != 1 || strategy.Repos[0] != repoPath {
+		t.Errorf("Repos = %v, want [%s]", strategy.Repos, repoPath)
+	}
+	if len(strategy.Blobs) != 0 || len(strategy.Snapshots) != 0 || len(strategy.Refs) != 0 {
+		t.Errorf("only the repos should be deleted, got blobs %v, snapshots %v and refs %v", strategy.Blobs, strategy.Snapshots, strategy.Refs)
+	}
+	if len(strategy.MissingRevisions) != 1 || strategy.MissingRevisions[0] != missingRevision {
+		t.Errorf("MissingRevisions = %v, want [%s]", strategy.MissingRevisions, missingRevision)
+	}
+
+	if err := strategy.Execute(); err != nil {
+		t.Fatal(err)
+	}
+
+	assertExists(t, repoPath, false)
+	if info := scanTestCache(t, cacheDir); len(info.Repos) != 1 || info.Repos[0].RepoPath != otherRepoPath {
+		t.Errorf("only %s should be left in the cache", otherRepoPath)
+	}
+
+	// Deleting the same paths again isn't an error
+	if err := strategy.Execute(); err != nil {
+		t.Errorf("Execute on deleted paths: %s", err)
+	}
+}
+
+// lockBlob holds the download lock of a blob, as a download in another process would.
+func lockBlob(t *testing.T, repoPath, blobPath string) *flock.Flock {
+	t.Helper()
+
+	lockPath := filepath.Join(repoPath, ".locks", filepath.Base(blobPath)+".lock")
+	if err := os.MkdirAll(filepath.Dir(lockPath), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	lock := flock.New(lockPath)
+	if err := lock.Lock(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { lock.Unlock() })
+	return lock
+}
+
+func TestPruneCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	cacheDir := t.TempDir()
+	repoPath := filepath.Join(cacheDir, "models--org--repo")
+	otherRepoPath := filepath.Join(cacheDir, "models--org--other")
+	now := time.Now()
+
+	oldBlob := writeCachedFile(t, repoPath, commitA, "model.bin", "aaaa", now.Add(-2*time.Hour))
+	newBlob := writeCachedFile(t, repoPath, commitB, "model.bin", "bbbb", now)
+	// The other repo is a fork that shares commitA, whose revision must be evicted in each repo separately
+	otherBlob := writeCachedFile(t, otherRepoPath, commitA, "model.bin", "cccc", now.Add(-time.Hour))
+
+	freed, err := pruneCache(scanTestCache(t, cacheDir), 4, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if freed != 8 {
+		t.Errorf("freed = %d, want 8", freed)
+	}
+
+	assertExists(t, oldBlob, false)
+	assertExists(t, otherRepoPath, false)
+	assertExists(t, otherBlob, false)
+	assertExists(t, newBlob, true)
+
+	// The cache already fits, so nothing is evicted
+	freed, err = pruneCache(scanTestCache(t, cacheDir), 4, nil)
+	if err != nil || freed != 0 {
+		t.Errorf("pruneCache = %d, %v, want 0, nil", freed, err)
+	}
+}
+
+func TestPruneCacheSkipsLockedRevisions(t *testing.T) {
+	cacheDir := t.TempDir()
+	repoPath := filepath.Join(cacheDir, "models--org--repo")
+	otherRepoPath := filepath.Join(cacheDir, "models--org--other")
+	now := time.Now()
+
+	lockedBlob := writeCachedFile(t, repoPath, commitA, "model.bin", "aaaa", now.Add(-2*time.Hour))
+	evictedBlob := writeCachedFile(t, repoPath, commitB, "model.bin", "bbbb", now.Add(-time.Hour))
+	otherBlob := writeCachedFile(t, otherRepoPath, commitA, "model.bin", "cccc", now.Add(-3*time.Hour))
+	lockBlob(t, repoPath, lockedBlob)
+	// A download in progress in the other repo locks a blob that no revision uses yet, which keeps the repo from
+	// being deleted as a whole
+	lockBlob(t, otherRepoPath, filepath.Join(otherRepoPath, "blobs", "incomplete"))
+
+	freed, err := pruneCache(scanTestCache(t, cacheDir), 4, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if freed != 4 {
+		t.Errorf("freed = %d, want 4", freed)
+	}
+
+	assertExists(t, lockedBlob, true)
+	assertExists(t, otherBlob, true)
+	assertExists(t, evictedBlob, false)
+	assertExists(t, filepath.Join(repoPath, "snapshots", commitB), false)
+}
+
+func TestPruneCacheKeepsDownloadingRevision(t *testing.T) {
+	cacheDir := t.TempDir()
+	repoPath := filepath.Join(cacheDir, "models--org--repo")
+	now := time.Now()
+
+	downloadingBlob := writeCachedFile(t, repoPath, commitA, "model.bin", "aaaa", now.Add(-time.Hour))
+	writeCachedFile(t, repoPath, commitB, "model.bin", "bbbb", now)
+	downloading := &cachedRevisionKey{filepath.Base(repoPath), commitA}
+
+	freed, err := pruneCache(scanTestCache(t, cacheDir), 0, downloading)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if freed != 4 {
+		t.Errorf("freed = %d, want 4", freed)
+	}
+
+	assertExists(t, downloadingBlob, true)
+	assertExists(t, filepath.Join(repoPath, "snapshots", commitB), false)
+
+	// The downloading revision is now the last one of its repo, which must not be deleted as a whole either
+	freed, err = pruneCache(scanTestCache(t, cacheDir), 0, downloading)
+	if err != nil || freed != 0 {
+		t.Errorf("pruneCache = %d, %v, want 0, nil", freed, err)
+	}
+	assertExists(t, downloadingBlob, true)
+}
+
+func TestMakeRoomInCacheKeepsDownloadingRevision(t *testing.T) {
+	cacheDir := t.TempDir()
+	repoPath := filepath.Join(cacheDir, "models--org--repo")
+	now := time.Now()
+
+	// The revision being downloaded into is the least recently used one, and a newer revision is evicted instead
+	downloadingBlob := writeCachedFile(t, repoPath, commitA, "a.bin", "aaaa", now.Add(-time.Hour))
+	writeCachedFile(t, repoPath, commitB, "b.bin", "bbbb", now)
+
+	client := NewClient(defaultHfEndpoint, "", cacheDir).WithMaxCacheSize(10)
+	client.makeRoomInCache(4, &cachedRevisionKey{filepath.Base(repoPath), commitA})
+
+	assertExists(t, downloadingBlob, true)
+	assertExists(t, filepath.Join(repoPath, "snapshots", commitB), false)
+}
+
+func TestTryLockAll(t *testing.T) {
+	lockDir := t.TempDir()
+	freePath := filepath.Join(lockDir, "free.lock")
+	heldPath := filepath.Join(lockDir, "held.lock")
+	missingPath := filepath.Join(lockDir, "missing", "blob.lock")
+
+	locks, ok := tryLockAll([]string{freePath, missingPath})
+	if !ok || len(locks) != 1 {
+		t.Fatalf("tryLockAll = %d locks, %v, want 1 lock, true", len(locks), ok)
+	}
+	locks[0].Unlock()
+
+	held := flock.New(heldPath)
+	if err := held.Lock(); err != nil {
+		t.Fatal(err)
+	}
+	defer held.Unlock()
+
+	if locks, ok := tryLockAll([]string{freePath, heldPath}); ok || locks != nil {
+		t.Fatalf("tryLockAll = %d locks, %v, want no locks, false", len(locks), ok)
+	}
+
+	// The locks taken before the held one are released
+	lock := flock.New(freePath)
+	if locked, err := lock.TryLock(); err != nil || !locked {
+		t.Errorf("%s wasn't released: %v", freePath, err)
+	}
+	lock.Unlock()
+}
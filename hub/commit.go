@@ -0,0 +1,672 @@
+package hub
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"math"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// CommitOperation is an operation of a commit: CommitOperationAdd, CommitOperationDelete or CommitOperationCopy.
+type CommitOperation interface {
+	commitOperation()
+}
+
+// CommitOperationAdd adds (or overwrites) a file in the repo. Its content is Content when it is set,
+// or the file at LocalPath otherwise. Large files are uploaded to LFS, small ones are sent inline with the commit.
+type CommitOperationAdd struct {
+	PathInRepo string
+	LocalPath  string
+	Content    []byte
+
+	uploadInfo *uploadInfo
+	uploadMode string
+}
+
+// CommitOperationDelete deletes a file from the repo, or a whole folder when IsFolder is set.
+type CommitOperationDelete struct {
+	PathInRepo string
+	IsFolder   bool
+}
+
+// CommitOperationCopy copies a file that already exists in the repo, at SrcRevision (defaults to the commit revision).
+// LFS files are copied without being downloaded.
+type CommitOperationCopy struct {
+	SrcPathInRepo string
+	PathInRepo    string
+	SrcRevision   string
+}
+
+func (*CommitOperationAdd) commitOperation()    {}
+func (*CommitOperationDelete) commitOperation() {}
+func (*CommitOperationCopy) commitOperation()   {}
+
+// CommitInfo describes a commit created on the Hub. CommitOid can be used as a revision, e.g. with Repo.WithRevision.
+type CommitInfo struct {
+	CommitUrl      string
+	CommitOid      string
+	PullRequestUrl string
+}
+
+type uploadInfo struct {
+	size   int64
+	sha256 string
+	sample []byte
+}
+
+// lfsAction is an action (upload or verify) returned by the LFS batch endpoint.
+// The header values are strings, except for multipart uploads where `chunk_size` may be a number.
+type lfsAction struct {
+	Href   string                     `json:"href"`
+	Header map[string]json.RawMessage `json:"header"`
+}
+
+type lfsBatchObject struct {
+	Oid     string `json:"oid"`
+	Size    int64  `json:"size"`
+	Actions struct {
+		Upload *lfsAction `json:"upload"`
+		Verify *lfsAction `json:"verify"`
+	} `json:"actions"`
+	Error *struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// copySource is the source file of a copy operation. content is only set for regular (non-LFS) files.
+type copySource struct {
+	info    *RepoTreeEntry
+	content []byte
+}
+
+const (
+	uploadModeLfs     = "lfs"
+	uploadModeRegular = "regular"
+	// commitBatchSize is the number of files sent per preupload and LFS batch request, as in the python package.
+	commitBatchSize = 256
+	lfsContentType  = "application/vnd.git-lfs+json"
+)
+
+// CreateCommit creates a commit with the given operations on repo.Revision (defaults to the main branch),
+// and returns the new commit. Port of `HfApi.create_commit` from the python package.
+func (client *Client) CreateCommit(ctx context.Context, repo *Repo, operations []CommitOperation, message string) (*CommitInfo, error) {
+	if message == "" {
+		return nil, fmt.Errorf("a commit message is required")
+	}
+
+	var additions []*CommitOperationAdd
+	var copies []*CommitOperationCopy
+	for _, operation := range operations {
+		switch op := operation.(type) {
+		case *CommitOperationAdd:
+			op.PathInRepo = cleanPathInRepo(op.PathInRepo)
+			additions = append(additions, op)
+		case *CommitOperationDelete:
+			op.PathInRepo = cleanPathInRepo(op.PathInRepo)
+		case *CommitOperationCopy:
+			op.SrcPathInRepo = cleanPathInRepo(op.SrcPathInRepo)
+			op.PathInRepo = cleanPathInRepo(op.PathInRepo)
+			copies = append(copies, op)
+		default:
+			return nil, fmt.Errorf("unknown commit operation: %T", operation)
+		}
+	}
+
+	for _, addition := range additions {
+		if err := addition.computeUploadInfo(); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := client.fetchUploadModes(ctx, repo, additions); err != nil {
+		return nil, err
+	}
+
+	var lfsAdditions []*CommitOperationAdd
+	for _, addition := range additions {
+		if addition.uploadMode == uploadModeLfs {
+			lfsAdditions = append(lfsAdditions, addition)
+		}
+	}
+	if err := client.uploadLfsFiles(ctx, repo, lfsAdditions); err != nil {
+		return nil, err
+	}
+
+	filesToCopy, err := client.fetchFilesToCopy(ctx, repo, copies)
+	if err != nil {
+		return nil, err
+	}
+
+	payload, err := commitPayload(operations, filesToCopy, message)
+	if err != nil {
+		return nil, err
+	}
+
+	commitUrl, err := formatUrl(hfCommitTemplate, client.repoUrlParams(repo, ""))
+	if err != nil {
+		return nil, err
+	}
+
+	headers := client.buildHeaders()
+	headers.Set("Content-Type", "application/x-ndjson")
+	response, err := client.requestWrapper(ctx, "POST", commitUrl, true, true, headers, bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	if err := hfRaiseForStatus(response); err != nil {
+		return nil, err
+	}
+
+	var data struct {
+		CommitUrl   string `json:"commitUrl"`
+		CommitOid   string `json:"commitOid"`
+		PullRequest *struct {
+			Url string `json:"url"`
+		} `json:"pullRequest"`
+	}
+	if err := json.NewDecoder(response.Body).Decode(&data); err != nil {
+		return nil, err
+	}
+
+	commitInfo := &CommitInfo{
+		CommitUrl: data.CommitUrl,
+		CommitOid: data.CommitOid,
+	}
+	if data.PullRequest != nil {
+		commitInfo.PullRequestUrl = data.PullRequest.Url
+	}
+
+	return commitInfo, nil
+}
+
+// UploadFolder commits every file of a local folder to pathInRepo (the root of the repo when empty).
+// The `.git` folder and the `.cache/huggingface` folder of local directory downloads are skipped.
+func (client *Client) UploadFolder(ctx context.Context, repo *Repo, folderPath string, pathInRepo string, message string) (*CommitInfo, error) {
+	var operations []CommitOperation
+	err := filepath.WalkDir(folderPath, func(filePath string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		relativePath, err := filepath.Rel(folderPath, filePath)
+		if err != nil {
+			return err
+		}
+		relativePath = filepath.ToSlash(relativePath)
+
+		if entry.IsDir() {
+			if relativePath == ".git" || relativePath == ".cache/huggingface" {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		operations = append(operations, &CommitOperationAdd{
+			PathInRepo: path.Join(pathInRepo, relativePath),
+			LocalPath:  filePath,
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return client.CreateCommit(ctx, repo, operations, message)
+}
+
+// computeUploadInfo computes the size, sha256 and sample (first 512 bytes) of the file to add.
+func (op *CommitOperationAdd) computeUploadInfo() error {
+	if op.uploadInfo != nil {
+		return nil
+	}
+
+	reader, closeReader, err := op.open()
+	if err != nil {
+		return err
+	}
+	defer closeReader()
+
+	hash := sha256.New()
+	size, err := io.Copy(hash, reader)
+	if err != nil {
+		return err
+	}
+
+	sample := make([]byte, min(size, 512))
+	if _, err := reader.ReadAt(sample, 0); err != nil && !errors.Is(err, io.EOF) {
+		return err
+	}
+
+	op.uploadInfo = &uploadInfo{
+		size:   size,
+		sha256: hex.EncodeToString(hash.Sum(nil)),
+		sample: sample,
+	}
+	return nil
+}
+
+// open returns the content of the file to add, and a function to release it.
+func (op *CommitOperationAdd) open() (*io.SectionReader, func(), error) {
+	if op.Content != nil || op.LocalPath == "" {
+		return io.NewSectionReader(bytes.NewReader(op.Content), 0, int64(len(op.Content))), func() {}, nil
+	}
+
+	file, err := os.Open(op.LocalPath)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, nil, err
+	}
+
+	return io.NewSectionReader(file, 0, info.Size()), func() { file.Close() }, nil
+}
+
+// fetchUploadModes asks the Hub which files must be uploaded to LFS, and which ones can be sent inline with the commit.
+func (client *Client) fetchUploadModes(ctx context.Context, repo *Repo, additions []*CommitOperationAdd) error {
+	preuploadUrl, err := formatUrl(hfPreuploadTemplate, client.repoUrlParams(repo, ""))
+	if err != nil {
+		return err
+	}
+
+	for start := 0; start < len(additions); start += commitBatchSize {
+		chunk := additions[start:min(start+commitBatchSize, len(additions))]
+
+		type preuploadFile struct {
+			Path   string `json:"path"`
+			Sample string `json:"sample"`
+			Size   int64  `json:"size"`
+		}
+		payload := struct {
+			Files []preuploadFile `json:"files"`
+		}{}
+		for _, addition := range chunk {
+			payload.Files = append(payload.Files, preuploadFile{
+				Path:   addition.PathInRepo,
+				Sample: base64.StdEncoding.EncodeToString(addition.uploadInfo.sample),
+				Size:   addition.uploadInfo.size,
+			})
+		}
+
+		var data struct {
+			Files []struct {
+				Path       string `json:"path"`
+				UploadMode string `json:"uploadMode"`
+			} `json:"files"`
+		}
+		if _, err := client.apiRequest(ctx, "POST", preuploadUrl, nil, payload, &data); err != nil {
+			return err
+		}
+
+		uploadModes := make(map[string]string, len(data.Files))
+		for _, file := range data.Files {
+			uploadModes[file.Path] = file.UploadMode
+		}
+
+		for _, addition := range chunk {
+			addition.uploadMode = uploadModes[addition.PathInRepo]
+			// Empty files cannot be uploaded to LFS
+			if addition.uploadMode == "" || addition.uploadInfo.size == 0 {
+				addition.uploadMode = uploadModeRegular
+			}
+		}
+	}
+
+	return nil
+}
+
+// uploadLfsFiles uploads the LFS files through the batch API. Files already stored on the Hub are skipped.
+func (client *Client) uploadLfsFiles(ctx context.Context, repo *Repo, additions []*CommitOperationAdd) error {
+	params := client.repoUrlParams(repo, "")
+	batchUrl, err := formatUrl(hfLfsBatchTemplate, params)
+	if err != nil {
+		return err
+	}
+
+	revision, err := url.PathUnescape(params["Revision"])
+	if err != nil {
+		return err
+	}
+
+	for start := 0; start < len(additions); start += commitBatchSize {
+		chunk := additions[start:min(start+commitBatchSize, len(additions))]
+
+		type lfsObject struct {
+			Oid  string `json:"oid"`
+			Size int64  `json:"size"`
+		}
+		payload := struct {
+			Operation string            `json:"operation"`
+			Transfers []string          `json:"transfers"`
+			Objects   []lfsObject       `json:"objects"`
+			HashAlgo  string            `json:"hash_algo"`
+			Ref       map[string]string `json:"ref"`
+		}{
+			Operation: "upload",
+			Transfers: []string{"basic", "multipart"},
+			HashAlgo:  "sha256",
+			Ref:       map[string]string{"name": revision},
+		}
+		additionsByOid := make(map[string]*CommitOperationAdd, len(chunk))
+		for _, addition := range chunk {
+			payload.Objects = append(payload.Objects, lfsObject{Oid: addition.uploadInfo.sha256, Size: addition.uploadInfo.size})
+			additionsByOid[addition.uploadInfo.sha256] = addition
+		}
+
+		headers := client.buildHeaders()
+		headers.Set("Accept", lfsContentType)
+		headers.Set("Content-Type", lfsContentType)
+
+		var data struct {
+			Objects []lfsBatchObject `json:"objects"`
+		}
+		if _, err := client.apiRequest(ctx, "POST", batchUrl, headers, payload, &data); err != nil {
+			return err
+		}
+
+		for _, object := range data.Objects {
+			if object.Error != nil {
+				return fmt.Errorf("LFS batch error for %s: %d %s", object.Oid, object.Error.Code, object.Error.Message)
+			}
+
+			// No upload action means the file is already stored on the Hub
+			if object.Actions.Upload == nil {
+				continue
+			}
+
+			addition, ok := additionsByOid[object.Oid]
+			if !ok {
+				return fmt.Errorf("LFS batch returned an unexpected object: %s", object.Oid)
+			}
+
+			if err := client.uploadLfsObject(ctx, addition, &object); err != nil {
+				return fmt.Errorf("error while uploading %s to LFS: %w", addition.PathInRepo, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+func (client *Client) uploadLfsObject(ctx context.Context, addition *CommitOperationAdd, object *lfsBatchObject) error {
+	reader, closeReader, err := addition.open()
+	if err != nil {
+		return err
+	}
+	defer closeReader()
+
+	upload := object.Actions.Upload
+	if _, ok := upload.Header["chunk_size"]; ok {
+		err = client.uploadLfsMultipart(ctx, reader, addition.uploadInfo, upload)
+	} else {
+		err = client.uploadLfsPart(ctx, upload.Href, reader, nil)
+	}
+	if err != nil {
+		return err
+	}
+
+	verify := object.Actions.Verify
+	if verify != nil {
+		headers := client.buildHeaders()
+		for key, value := range verify.Header {
+			headers.Set(key, lfsHeaderValue(value))
+		}
+
+		payload := map[string]any{"oid": addition.uploadInfo.sha256, "size": addition.uploadInfo.size}
+		if _, err := client.apiRequest(ctx, "POST", verify.Href, headers, payload, nil); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// uploadLfsMultipart uploads a file in parts, to the part URLs given in the numbered keys of the upload
+// action header, then sends the etags of the parts to complete the upload.
+func (client *Client) uploadLfsMultipart(ctx context.Context, reader *io.SectionReader, info *uploadInfo, upload *lfsAction) error {
+	chunkSize, err := strconv.ParseInt(lfsHeaderValue(upload.Header["chunk_size"]), 10, 64)
+	if err != nil || chunkSize <= 0 {
+		return fmt.Errorf("invalid LFS chunk size: %s", upload.Header["chunk_size"])
+	}
+
+	partUrls := make(map[int]string)
+	var partNumbers []int
+	for key, value := range upload.Header {
+		if partNumber, err := strconv.Atoi(key); err == nil {
+			partUrls[partNumber] = lfsHeaderValue(value)
+			partNumbers = append(partNumbers, partNumber)
+		}
+	}
+	sort.Ints(partNumbers)
+
+	if len(partNumbers) != int(math.Ceil(float64(info.size)/float64(chunkSize))) {
+		return fmt.Errorf("invalid server response to upload large LFS file: %d parts for %d bytes", len(partNumbers), info.size)
+	}
+
+	type completedPart struct {
+		PartNumber int    `json:"partNumber"`
+		Etag       string `json:"etag"`
+	}
+	parts := make([]completedPart, len(partNumbers))
+	for i, partNumber := range partNumbers {
+		offset := int64(i) * chunkSize
+		part := io.NewSectionReader(reader, offset, min(chunkSize, info.size-offset))
+
+		var etag string
+		if err := client.uploadLfsPart(ctx, partUrls[partNumber], part, &etag); err != nil {
+			return err
+		}
+		if etag == "" {
+			return fmt.Errorf("no etag returned for part %d", partNumber)
+		}
+
+		parts[i] = completedPart{PartNumber: i + 1, Etag: etag}
+	}
+
+	headers := &http.Header{}
+	headers.Set("Accept", lfsContentType)
+	headers.Set("Content-Type", lfsContentType)
+
+	payload := map[string]any{"oid": info.sha256, "parts": parts}
+	_, err = client.apiRequest(ctx, "POST", upload.Href, headers, payload, nil)
+	return err
+}
+
+// uploadLfsPart sends a PUT request to a pre-signed storage URL, which must not receive the Hub headers.
+// The etag of the uploaded content is stored in etag when it isn't nil.
+func (client *Client) uploadLfsPart(ctx context.Context, uploadUrl string, body io.ReadSeeker, etag *string) error {
+	response, err := client.requestWrapper(ctx, "PUT", uploadUrl, true, true, &http.Header{}, body)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if err := hfRaiseForStatus(response); err != nil {
+		return err
+	}
+
+	if etag != nil {
+		*etag = response.Header.Get("ETag")
+	}
+	return nil
+}
+
+// fetchFilesToCopy resolves the source files of the copy operations. LFS files are copied by reference
+// to their sha256, while the content of regular files is downloaded to be committed again.
+func (client *Client) fetchFilesToCopy(ctx context.Context, repo *Repo, copies []*CommitOperationCopy) (map[*CommitOperationCopy]*copySource, error) {
+	filesToCopy := make(map[*CommitOperationCopy]*copySource, len(copies))
+
+	copiesByRevision := make(map[string][]*CommitOperationCopy)
+	for _, op := range copies {
+		copiesByRevision[op.SrcRevision] = append(copiesByRevision[op.SrcRevision], op)
+	}
+
+	for srcRevision, revisionCopies := range copiesByRevision {
+		paths := make([]string, len(revisionCopies))
+		for i, op := range revisionCopies {
+			paths[i] = op.SrcPathInRepo
+		}
+
+		infos, err := client.getPathsInfo(ctx, repo, srcRevision, paths)
+		if err != nil {
+			return nil, err
+		}
+
+		infosByPath := make(map[string]*RepoTreeEntry, len(infos))
+		for _, info := range infos {
+			infosByPath[info.Path] = info
+		}
+
+		for _, op := range revisionCopies {
+			info, ok := infosByPath[op.SrcPathInRepo]
+			if !ok || !info.IsFile() {
+				return nil, fmt.Errorf("cannot copy %s at revision %s: file not found", op.SrcPathInRepo, srcRevision)
+			}
+
+			source := &copySource{info: info}
+			if info.Lfs == nil {
+				source.content, err = client.readRepoFile(ctx, repo, srcRevision, op.SrcPathInRepo)
+				if err != nil {
+					return nil, err
+				}
+			}
+			filesToCopy[op] = source
+		}
+	}
+
+	return filesToCopy, nil
+}
+
+func (client *Client) getPathsInfo(ctx context.Context, repo *Repo, revision string, paths []string) ([]*RepoTreeEntry, error) {
+	pathsInfoUrl, err := formatUrl(hfPathsInfoTemplate, client.repoUrlParams(repo, revision))
+	if err != nil {
+		return nil, err
+	}
+
+	form := url.Values{"paths": paths}
+	headers := client.buildHeaders()
+	headers.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	response, err := client.requestWrapper(ctx, "POST", pathsInfoUrl, true, true, headers, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	if err := hfRaiseForStatus(response); err != nil {
+		return nil, err
+	}
+
+	var infos []*RepoTreeEntry
+	if err := json.NewDecoder(response.Body).Decode(&infos); err != nil {
+		return nil, err
+	}
+	return infos, nil
+}
+
+// readRepoFile downloads the content of a (small) file of the repo, without caching it.
+func (client *Client) readRepoFile(ctx context.Context, repo *Repo, revision string, pathInRepo string) ([]byte, error) {
+	response, err := client.requestWrapper(ctx, "GET", client.FileURL(repo, pathInRepo, revision), true, true, client.buildHeaders(), nil)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	if err := hfRaiseForStatus(response); err != nil {
+		return nil, err
+	}
+
+	return io.ReadAll(response.Body)
+}
+
+// commitPayload builds the NDJSON body of the commit endpoint: a header line, then one line per operation.
+func commitPayload(operations []CommitOperation, filesToCopy map[*CommitOperationCopy]*copySource, message string) ([]byte, error) {
+	type payloadLine struct {
+		Key   string         `json:"key"`
+		Value map[string]any `json:"value"`
+	}
+
+	lines := []payloadLine{{Key: "header", Value: map[string]any{"summary": message, "description": ""}}}
+	for _, operation := range operations {
+		switch op := operation.(type) {
+		case *CommitOperationAdd:
+			if op.uploadMode == uploadModeLfs {
+				lines = append(lines, payloadLine{Key: "lfsFile", Value: map[string]any{"path": op.PathInRepo, "algo": "sha256", "oid": op.uploadInfo.sha256}})
+				continue
+			}
+
+			reader, closeReader, err := op.open()
+			if err != nil {
+				return nil, err
+			}
+			content, err := io.ReadAll(reader)
+			closeReader()
+			if err != nil {
+				return nil, err
+			}
+
+			lines = append(lines, payloadLine{Key: "file", Value: map[string]any{"path": op.PathInRepo, "encoding": "base64", "content": base64.StdEncoding.EncodeToString(content)}})
+		case *CommitOperationDelete:
+			key := "deletedFile"
+			if op.IsFolder {
+				key = "deletedFolder"
+			}
+			lines = append(lines, payloadLine{Key: key, Value: map[string]any{"path": op.PathInRepo}})
+		case *CommitOperationCopy:
+			source := filesToCopy[op]
+			if source.info.Lfs != nil {
+				lines = append(lines, payloadLine{Key: "lfsFile", Value: map[string]any{"path": op.PathInRepo, "algo": "sha256", "oid": source.info.Lfs.Oid}})
+				continue
+			}
+
+			lines = append(lines, payloadLine{Key: "file", Value: map[string]any{"path": op.PathInRepo, "encoding": "base64", "content": base64.StdEncoding.EncodeToString(source.content)}})
+		}
+	}
+
+	var payload bytes.Buffer
+	encoder := json.NewEncoder(&payload)
+	for _, line := range lines {
+		if err := encoder.Encode(line); err != nil {
+			return nil, err
+		}
+	}
+
+	return payload.Bytes(), nil
+}
+
+// lfsHeaderValue returns the value of an LFS action header, which can be a JSON string or number.
+func lfsHeaderValue(raw json.RawMessage) string {
+	var value string
+	if err := json.Unmarshal(raw, &value); err == nil {
+		return value
+	}
+	return string(raw)
+}
+
+// cleanPathInRepo normalizes a path in the repo, which is always relative to its root and `/`-separated.
+func cleanPathInRepo(pathInRepo string) string {
+	pathInRepo = filepath.ToSlash(pathInRepo)
+	pathInRepo = strings.TrimPrefix(pathInRepo, "./")
+	return strings.TrimPrefix(pathInRepo, "/")
+}
@@ -0,0 +1,225 @@
+package hub
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Sentinel errors matching the error types below with errors.Is, e.g. errors.Is(err, ErrEntryNotFound).
+var (
+	ErrRepositoryNotFound = errors.New("repository not found")
+	ErrRevisionNotFound   = errors.New("revision not found")
+	ErrEntryNotFound      = errors.New("entry not found")
+	ErrGatedRepo          = errors.New("gated repo")
+	ErrLocalEntryNotFound = errors.New("local entry not found")
+	// ErrChecksumMismatch is returned when a downloaded file doesn't match the hash of its ETag.
+	ErrChecksumMismatch = errors.New("checksum mismatch")
+)
+
+// HTTPError is returned when the Hub answers a request with an error status.
+// The more specific errors below wrap it, so errors.As(err, &httpErr) works for all of them.
+type HTTPError struct {
+	StatusCode int
+	URL        string
+	// RequestID identifies the request in the Hub logs, to be shared when reporting an issue.
+	RequestID string
+	// ErrorCode is the value of the X-Error-Code header, e.g. "EntryNotFound".
+	ErrorCode     string
+	ServerMessage string
+	// RetryAfter is how long the server asked to wait before retrying, from the Retry-After header.
+	RetryAfter time.Duration
+}
+
+func (e *HTTPError) Error() string {
+	message := fmt.Sprintf("%d %s for url: %s", e.StatusCode, http.StatusText(e.StatusCode), e.URL)
+	if e.RequestID != "" {
+		message += fmt.Sprintf(" (Request ID: %s)", e.RequestID)
+	}
+	if e.ServerMessage != "" {
+		message += fmt.Sprintf(": %s", e.ServerMessage)
+	}
+
+	return message
+}
+
+// RepositoryNotFoundError is returned when the repo doesn't exist, or is private and the token can't access it.
+type RepositoryNotFoundError struct {
+	*HTTPError
+}
+
+func (e *RepositoryNotFoundError) Error() string {
+	return fmt.Sprintf("repository not found, make sure the repo id is correct and that you are authenticated if it is private or gated: %s", e.HTTPError)
+}
+
+func (e *RepositoryNotFoundError) Unwrap() error {
+	return e.HTTPError
+}
+
+func (e *RepositoryNotFoundError) Is(target error) bool {
+	return target == ErrRepositoryNotFound
+}
+
+// RevisionNotFoundError is returned when the repo exists but the revision (branch, tag or commit) doesn't.
+type RevisionNotFoundError struct {
+	*HTTPError
+}
+
+func (e *RevisionNotFoundError) Error() string {
+	return fmt.Sprintf("revision not found: %s", e.HTTPError)
+}
+
+func (e *RevisionNotFoundError) Unwrap() error {
+	return e.HTTPError
+}
+
+func (e *RevisionNotFoundError) Is(target error) bool {
+	return target == ErrRevisionNotFound
+}
+
+// EntryNotFoundError is returned when the repo and revision exist but the file doesn't.
+type EntryNotFoundError struct {
+	*HTTPError
+}
+
+func (e *EntryNotFoundError) Error() string {
+	return fmt.Sprintf("entry not found: %s", e.HTTPError)
+}
+
+func (e *EntryNotFoundError) Unwrap() error {
+	return e.HTTPError
+}
+
+func (e *EntryNotFoundError) Is(target error) bool {
+	return target == ErrEntryNotFound
+}
+
+// GatedRepoError is returned when the repo is gated and the token hasn't been granted access to it.
+type GatedRepoError struct {
+	*HTTPError
+}
+
+func (e *GatedRepoError) Error() string {
+	return fmt.Sprintf("access to this repo is restricted, you must be authenticated and have been granted access to it: %s", e.HTTPError)
+}
+
+func (e *GatedRepoError) Unwrap() error {
+	return e.HTTPError
+}
+
+func (e *GatedRepoError) Is(target error) bool {
+	return target == ErrGatedRepo
+}
+
+// LocalEntryNotFoundError is returned when a file or snapshot must be loaded from the cache (offline mode,
+// local files only, or network failure) but isn't there. Err is the error that prevented reaching the Hub, if any.
+type LocalEntryNotFoundError struct {
+	Message string
+	Err     error
+}
+
+func (e *LocalEntryNotFoundError) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("%s: %s", e.Message, e.Err)
+	}
+	return e.Message
+}
+
+func (e *LocalEntryNotFoundError) Unwrap() error {
+	return e.Err
+}
+
+func (e *LocalEntryNotFoundError) Is(target error) bool {
+	return target == ErrLocalEntryNotFound
+}
+
+// repoApiRegex matches the paths of the repo info APIs and of file downloads, as `REPO_API_REGEX` in the python package.
+var repoApiRegex = regexp.MustCompile(`^(/api/(models|datasets|spaces)/.+|/.+/resolve/.+)`)
+
+// hfRaiseForStatus returns a typed error when the response has an error status, based on the
+// X-Error-Code header the Hub sets. Port of `hf_raise_for_status` from the python package.
+func hfRaiseForStatus(response *http.Response) error {
+	if response.StatusCode < 400 {
+		return nil
+	}
+
+	httpErr := &HTTPError{
+		StatusCode:    response.StatusCode,
+		URL:           response.Request.URL.String(),
+		RequestID:     response.Header.Get("X-Request-Id"),
+		ErrorCode:     response.Header.Get("X-Error-Code"),
+		ServerMessage: serverErrorMessage(response),
+	}
+
+	if httpErr.RequestID == "" {
+		httpErr.RequestID = response.Header.Get("X-Amzn-Trace-Id")
+	}
+
+	// Retry-After is either a number of seconds or a date
+	if retryAfter := response.Header.Get("Retry-After"); retryAfter != "" {
+		if seconds, err := strconv.Atoi(retryAfter); err == nil {
+			httpErr.RetryAfter = time.Duration(seconds) * time.Second
+		} else if date, err := http.ParseTime(retryAfter); err == nil {
+			httpErr.RetryAfter = max(time.Until(date), 0)
+		}
+	}
+
+	switch httpErr.ErrorCode {
+	case "RepoNotFound":
+		return &RepositoryNotFoundError{httpErr}
+	case "RevisionNotFound":
+		return &RevisionNotFoundError{httpErr}
+	case "EntryNotFound":
+		return &EntryNotFoundError{httpErr}
+	case "GatedRepo":
+		return &GatedRepoError{httpErr}
+	}
+
+	// The Hub answers 401 for private repos to not leak their existence, unless the token itself is invalid.
+	// Like the python package, only the 401 of the repo APIs are concerned, not the ones of LFS or the CDN.
+	if response.StatusCode == http.StatusUnauthorized && repoApiRegex.MatchString(response.Request.URL.Path) &&
+		response.Header.Get("X-Error-Message") != "Invalid credentials in Authorization header" {
+		return &RepositoryNotFoundError{httpErr}
+	}
+
+	return httpErr
+}
+
+// serverErrorMessage extracts the error message sent by the Hub, either in the X-Error-Message header
+// or in the `error`/`errors` fields of a JSON body.
+func serverErrorMessage(response *http.Response) string {
+	if message := response.Header.Get("X-Error-Message"); message != "" {
+		return message
+	}
+
+	body, err := io.ReadAll(io.LimitReader(response.Body, 64*1024))
+	if err != nil || len(body) == 0 {
+		return ""
+	}
+
+	var data struct {
+		Error  string `json:"error"`
+		Errors []struct {
+			Message string `json:"message"`
+		} `json:"errors"`
+	}
+	if err := json.Unmarshal(body, &data); err != nil {
+		return strings.TrimSpace(string(body))
+	}
+
+	messages := []string{}
+	if data.Error != "" {
+		messages = append(messages, data.Error)
+	}
+	for _, e := range data.Errors {
+		messages = append(messages, e.Message)
+	}
+
+	return strings.Join(messages, "\n")
+}
@@ -1,12 +1,14 @@
 package hub
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"io"
 	"net"
 	"os"
 	"path/filepath"
+	"regexp"
 	"strings"
 
 	"github.com/cozy-creator/hf-hub/hub/utils"
@@ -21,6 +23,11 @@ func isOfflineError(err error) bool {
 	var dnsErr *net.DNSError
 	var syscallErr *os.SyscallError
 
+	// A cancelled or expired context is not a connectivity problem
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+
 	// Check if the error is a network operation error
 	if errors.Is(err, net.ErrClosed) || errors.Is(err, os.ErrDeadlineExceeded) {
 		return true
@@ -50,11 +57,23 @@ func isOfflineError(err error) bool {
 	return false
 }
 
+func isValidRepoType(repoType string) bool {
+	for _, validType := range RepoTypes {
+		if repoType == validType {
+			return true
+		}
+	}
+	return false
+}
+
 func isSymlinkSupported(cacheDir string) (bool, error) {
 	if cacheDir == "" {
 		return false, nil
 	}
 
+	symlinkSupportedLock.Lock()
+	defer symlinkSupportedLock.Unlock()
+
 	if symlinkSupported != nil {
 		if _, ok := symlinkSupported[cacheDir]; ok {
 			return true, nil
@@ -141,10 +160,10 @@ func createSymlink(src string, dst string, newBlob bool) error {
 				if newBlob {
 					err := os.Rename(src, dst)
 					if err != nil {
-						mustCopy(src, dst)
+						return copyFile(src, dst)
 					}
 				} else {
-					mustCopy(src, dst)
+					return copyFile(src, dst)
 				}
 			}
 		}
@@ -160,23 +179,23 @@ func normalizeETag(etag string) string {
 	return etag
 }
 
-func mustCopy(src string, dst string) {
+func copyFile(src string, dst string) error {
 	srcFile, err := os.Open(src)
 	if err != nil {
-		panic(err)
+		return err
 	}
 	defer srcFile.Close()
 
 	dstFile, err := os.Create(dst)
 	if err != nil {
-		panic(err)
+		return err
 	}
-	defer dstFile.Close()
 
-	_, err = io.Copy(dstFile, srcFile)
-	if err != nil {
-		panic(err)
+	if _, err := io.Copy(dstFile, srcFile); err != nil {
+		dstFile.Close()
+		return err
 	}
+	return dstFile.Close()
 }
 
 func expandPath(path string) (string, error) {
@@ -206,3 +225,110 @@ func expandPath(path string) (string, error) {
 
 	return filepath.Clean(path), nil
 }
+
+// fnmatch reports whether name matches the shell-style pattern, with the same semantics as Python's `fnmatch`.
+// Unlike path.Match, `*` also matches `/`, so that `*.safetensors` matches files in sub-folders too.
+func fnmatch(name string, pattern string) bool {
+	re, err := regexp.Compile(translatePattern(pattern))
+	if err != nil {
+		return false
+	}
+
+	return re.MatchString(name)
+}
+
+// translatePattern converts a shell-style pattern to an anchored regular expression.
+// Port of `fnmatch.translate` from the Python standard library.
+func translatePattern(pattern string) string {
+	var result strings.Builder
+	result.WriteString("^(?s:")
+
+	// the pattern is read rune by rune, so that non-ASCII characters are quoted as a whole
+	runes := []rune(pattern)
+	i, n := 0, len(runes)
+	for i < n {
+		c := runes[i]
+		i++
+
+		switch c {
+		case '*':
+			result.WriteString(".*")
+		case '?':
+			result.WriteString(".")
+		case '[':
+			j := i
+			if j < n && runes[j] == '!' {
+				j++
+			}
+			if j < n && runes[j] == ']' {
+				j++
+			}
+			for j < n && runes[j] != ']' {
+				j++
+			}
+
+			if j >= n {
+				// No closing bracket, so it's a literal '['
+				result.WriteString(`\[`)
+				continue
+			}
+
+			class := strings.ReplaceAll(string(runes[i:j]), `\`, `\\`)
+			i = j + 1
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			} else if strings.HasPrefix(class, "^") {
+				class = `\` + class
+			}
+			result.WriteString("[" + class + "]")
+		default:
+			result.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+
+	result.WriteString(")$")
+	return result.String()
+}
+
+// filterRepoFiles keeps the files matching at least one of allowPatterns (if any) and none of ignorePatterns.
+// Patterns ending with a `/` match the whole folder.
+func filterRepoFiles(files []string, allowPatterns []string, ignorePatterns []string) []string {
+	// the patterns are compiled once, since they are matched against every file of the repo
+	compilePatterns := func(patterns []string) []*regexp.Regexp {
+		compiled := make([]*regexp.Regexp, 0, len(patterns))
+		for _, pattern := range patterns {
+			if strings.HasSuffix(pattern, "/") {
+				pattern += "*"
+			}
+			if re, err := regexp.Compile(translatePattern(pattern)); err == nil {
+				compiled = append(compiled, re)
+			}
+		}
+		return compiled
+	}
+
+	matchesAny := func(file string, patterns []*regexp.Regexp) bool {
+		for _, re := range patterns {
+			if re.MatchString(file) {
+				return true
+			}
+		}
+		return false
+	}
+
+	allowRegexps := compilePatterns(allowPatterns)
+	ignoreRegexps := compilePatterns(ignorePatterns)
+
+	var filtered []string
+	for _, file := range files {
+		if len(allowPatterns) > 0 && !matchesAny(file, allowRegexps) {
+			continue
+		}
+		if matchesAny(file, ignoreRegexps) {
+			continue
+		}
+		filtered = append(filtered, file)
+	}
+
+	return filtered
+}
@@ -0,0 +1,67 @@
+package hub
+
+import (
+	"slices"
+	"testing"
+)
+
+// The expected results are the ones of Python's `fnmatch.fnmatchcase`.
+func TestFnmatch(t *testing.T) {
+	tests := []struct {
+		name    string
+		pattern string
+		want    bool
+	}{
+		{"model.safetensors", "*.safetensors", true},
+		{"unet/model.safetensors", "*.safetensors", true},
+		{"unet/sub/model.bin", "unet/*", true},
+		{"model.bin", "*.safetensors", false},
+		{"model1.bin", "model?.bin", true},
+		{"model10.bin", "model?.bin", false},
+		{"a.txt", "[abc].txt", true},
+		{"d.txt", "[abc].txt", false},
+		{"b.txt", "[a-c].txt", true},
+		{"d.txt", "[!abc].txt", true},
+		{"a.txt", "[!abc].txt", false},
+		{"^.txt", "[^a].txt", true},
+		{"b.txt", "[^a].txt", false},
+		{"].txt", "[]].txt", true},
+		{"!.txt", "[]!].txt", true},
+		{"[a.txt", "[a.txt", true},
+		{"a.txt", "[a.txt", false},
+		{"model+bin", "model+bin", true},
+		{"x\ny", "x*y", true},
+		{"README.md", "readme.md", false},
+		{"données/é.txt", "données/*", true},
+		{"données/é.txt", "données/?.txt", true},
+		{"日本/語.json", "日本/[語]*", true},
+	}
+
+	for _, test := range tests {
+		if got := fnmatch(test.name, test.pattern); got != test.want {
+			t.Errorf("fnmatch(%q, %q) = %v, want %v", test.name, test.pattern, got, test.want)
+		}
+	}
+}
+
+func TestFilterRepoFiles(t *testing.T) {
+	files := []string{"config.json", "model.safetensors", "vae/model.safetensors", "vae/config.json", "text_encoder/model.bin"}
+
+	tests := []struct {
+		allow  []string
+		ignore []string
+		want   []string
+	}{
+		{nil, nil, files},
+		{[]string{"*.safetensors"}, nil, []string{"model.safetensors", "vae/model.safetensors"}},
+		{[]string{"vae/"}, nil, []string{"vae/model.safetensors", "vae/config.json"}},
+		{nil, []string{"vae/", "*.bin"}, []string{"config.json", "model.safetensors"}},
+		{[]string{"*.json"}, []string{"vae/*"}, []string{"config.json"}},
+	}
+
+	for _, test := range tests {
+		if got := filterRepoFiles(files, test.allow, test.ignore); !slices.Equal(got, test.want) {
+			t.Errorf("filterRepoFiles(%q, %q) = %q, want %q", test.allow, test.ignore, got, test.want)
+		}
+	}
+}
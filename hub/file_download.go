@@ -2,8 +2,13 @@ package hub
 
 import (
 	"bytes"
+	"context"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"fmt"
+	"hash"
 	"io"
 	"log"
 	"net/http"
@@ -18,102 +23,124 @@ import (
 
 	"github.com/cozy-creator/hf-hub/hub/utils"
 	"github.com/gofrs/flock"
-	"github.com/schollz/progressbar/v3"
 )
 
-func downloadFileStream(url string, incompleteFile *os.File, resumeSize int64, headers *http.Header, expectedSize int64, displayedFilename string, nbRetries int) error {
-	currentHeaders := headers.Clone()
-	if resumeSize > 0 {
-		currentHeaders.Set("Range", fmt.Sprintf("bytes=%d-", resumeSize))
-	}
-
-	r, err := requestWrapper("GET", url, true, true, &currentHeaders)
-	if err != nil {
-		if nbRetries <= 0 {
-			return fmt.Errorf("error while downloading from %s: %s\nMax retries exceeded", url, err)
+// downloadFileStream streams the file at url to incompleteFile, from resumeSize. The bytes written are also written
+// to hasher when it isn't nil, so that the content can be verified once downloaded. A connection lost in the middle
+// of the download is retried following the client's RetryPolicy, resuming from the last byte written.
+func downloadFileStream(ctx context.Context, client *Client, url string, incompleteFile *os.File, resumeSize int64, headers *http.Header, expectedSize int64, repoId string, displayedFilename string, hasher hash.Hash, limiter *RateLimiter) error {
+	progress := client.progressReporter()
+	started := false
+	offset := resumeSize
+
+	// stream downloads from offset until the end of the file. Only the errors happening while reading the body
+	// are retryable here, since requestWrapper already retried the request itself.
+	stream := func() (written int64, retryable bool, err error) {
+		currentHeaders := headers.Clone()
+		if offset > 0 {
+			currentHeaders.Set("Range", fmt.Sprintf("bytes=%d-", offset))
 		}
 
-		if errors.Is(err, http.ErrHandlerTimeout) {
-			log.Printf("error while downloading from %s: %s\nTrying to resume download...\n", url, err)
-			time.Sleep(1 * time.Second)
-			return downloadFileStream(url, incompleteFile, resumeSize, headers, expectedSize, displayedFilename, nbRetries-1)
+		r, err := client.requestWrapper(ctx, "GET", url, true, true, &currentHeaders, nil)
+		if err != nil {
+			return 0, false, err
 		}
+		defer r.Body.Close()
 
-		return err
-	}
-	defer r.Body.Close()
-
-	// move to the position where we left off
-	_, err = incompleteFile.Seek(resumeSize, io.SeekStart)
-	if err != nil {
-		return err
-	}
-
-	contentLength, err := strconv.Atoi(r.Header.Get("Content-Length"))
-	if err != nil {
-		return err
-	}
+		if err := hfRaiseForStatus(r); err != nil {
+			return 0, false, err
+		}
 
-	// NOTE: 'totalBytes' is the totalBytes number of bytes to download, not the number of bytes in the file.
-	//       If the file is compressed, the number of bytes in the saved file will be higher than 'totalBytes'.
-	totalBytes := resumeSize + int64(contentLength)
-	// if totalBytes != expectedSize {
-	// 	return fmt.Errorf("expected size %d does not match actual size %d", expectedSize, totalBytes)
-	// }
-
-	if displayedFilename == "" {
-		displayedFilename = url
-		contentDisposition := r.Header.Get("Content-Disposition")
-		if contentDisposition != "" {
-			headerFilenamePattern := regexp.MustCompile(HeaderFilenamePattern)
-			match := headerFilenamePattern.FindStringSubmatch(contentDisposition)
-			if len(match) > 0 {
-				// Means file is on CDN
-				displayedFilename = match[1]
+		if offset > 0 && r.StatusCode != http.StatusPartialContent {
+			// The server sends the whole file, so the download starts over
+			log.Printf("the server doesn't support resuming the download of %s, starting over\n", url)
+			if err := incompleteFile.Truncate(0); err != nil {
+				return 0, false, err
 			}
+			if hasher != nil {
+				hasher.Reset()
+			}
+			offset = 0
 		}
-	}
-
-	if len(displayedFilename) > 40 {
-		displayedFilename = fmt.Sprintf("(…)%s", displayedFilename[len(displayedFilename)-40:])
-	}
 
-	consistencyErrorMessage := fmt.Sprintf("Consistency check failed: file should be of size %d but has size %d (%s). We are sorry for the inconvenience. Please retry with `force_download=True`. If the issue persists, please let us know by opening an issue on https://github.com/huggingface/huggingface_hub.", expectedSize, 0 /*/*incompleteFile.Tell()*/, displayedFilename)
+		if !started {
+			// NOTE: 'totalBytes' is the totalBytes number of bytes to download, not the number of bytes in the file.
+			//       If the file is compressed, the number of bytes in the saved file will be higher than 'totalBytes'.
+			//       The size of the file is checked against expectedSize once it is downloaded instead.
+			totalBytes := expectedSize
+			if contentLength, err := strconv.ParseInt(r.Header.Get("Content-Length"), 10, 64); err == nil {
+				totalBytes = offset + contentLength
+			}
 
-	progressbar := progressbar.DefaultBytes(totalBytes)
-	progressbar.Set64(resumeSize)
+			if displayedFilename == "" {
+				displayedFilename = url
+				contentDisposition := r.Header.Get("Content-Disposition")
+				if contentDisposition != "" {
+					headerFilenamePattern := regexp.MustCompile(HeaderFilenamePattern)
+					match := headerFilenamePattern.FindStringSubmatch(contentDisposition)
+					if len(match) > 0 {
+						// Means file is on CDN
+						displayedFilename = match[1]
+					}
+				}
+			}
 
-	newResumeSize := resumeSize
-	for {
-		if nbRetries <= 0 {
-			return fmt.Errorf("error while downloading from %s: %s\nMax retries exceeded", url, err)
+			progress.FileStarted(repoId, displayedFilename, totalBytes, offset)
+			started = true
 		}
 
 		buf := make([]byte, DownloadChunkSize)
-		n, err := r.Body.Read(buf)
-		if err != nil {
-			if errors.Is(err, io.EOF) {
-				break
+		for {
+			n, err := r.Body.Read(buf)
+			if n > 0 {
+				if waitErr := limiter.WaitN(ctx, n); waitErr != nil {
+					return written, false, waitErr
+				}
+
+				// Write the actual bytes read to the file
+				if _, writeErr := incompleteFile.Write(buf[:n]); writeErr != nil {
+					return written, false, fmt.Errorf("error writing to file: %v", writeErr)
+				}
+				if hasher != nil {
+					hasher.Write(buf[:n])
+				}
+
+				progress.BytesWritten(repoId, displayedFilename, int64(n))
+				offset += int64(n)
+				written += int64(n)
 			}
-			return err
-		}
 
-		if n > 0 {
-			// Write the actual bytes read to the file
-			if _, writeErr := incompleteFile.Write(buf[:n]); writeErr != nil {
-				return fmt.Errorf("error writing to file: %v", writeErr)
+			// the last chunk may come along with io.EOF, so it's only checked once the bytes are written
+			if err != nil {
+				if errors.Is(err, io.EOF) {
+					return written, false, nil
+				}
+				return written, true, err
 			}
+		}
+	}
 
-			progressbar.Add64(int64(n))
-			newResumeSize += int64(n)
+	policy := client.retryPolicy()
+	for failures := 0; ; failures++ {
+		written, retryable, err := stream()
+		if err == nil {
+			break
+		}
+		if !retryable {
+			return err
+		}
 
-			// Some data has been downloaded from the server so we reset the number of retries.
-			nbRetries = 5
+		// Some data has been downloaded from the server so we reset the number of retries.
+		if written > 0 {
+			failures = 0
+		}
+		if err := policy.retry(ctx, failures, err, fmt.Sprintf("download of %s", url)); err != nil {
+			return err
 		}
 	}
 
-	if expectedSize != 0 && newResumeSize != expectedSize {
-		return fmt.Errorf(consistencyErrorMessage, newResumeSize)
+	if expectedSize != 0 && offset != expectedSize {
+		return fmt.Errorf("consistency check failed: file should be of size %d but has size %d (%s). Please retry with ForceDownload", expectedSize, offset, displayedFilename)
 	}
 	return nil
 }
@@ -132,15 +159,17 @@ func formatUrl(urlTemplate string, params map[string]string) (string, error) {
 	return urlBytes.String(), nil
 }
 
-func requestWrapper(
+func (client *Client) requestWrapper(
+	ctx context.Context,
 	method,
 	rawUrl string,
 	allowRedirects,
 	followRelativeRedirects bool,
 	headers *http.Header,
+	body io.ReadSeeker,
 ) (*http.Response, error) {
 	if followRelativeRedirects {
-		response, err := requestWrapper(method, rawUrl, allowRedirects, false, headers)
+		response, err := client.requestWrapper(ctx, method, rawUrl, allowRedirects, false, headers, body)
 		if err != nil {
 			return nil, err
 		}
@@ -148,6 +177,7 @@ func requestWrapper(
 		if response.StatusCode >= 300 && response.StatusCode <= 399 {
 			parsedTarget, err := url.Parse(response.Header.Get("Location"))
 			if err != nil {
+				response.Body.Close()
 				return nil, err
 			}
 			if parsedTarget.Host == "" {
@@ -157,127 +187,281 @@ func requestWrapper(
 				//
 				// Highly inspired by `resolve_redirects` from requests library.
 				// See https://github.com/psf/requests/blob/main/requests/sessions.py#L159
-				nextUrl := url.URL{
-					Scheme:   parsedTarget.Scheme,
-					Host:     parsedTarget.Host,
-					Path:     parsedTarget.Path,
-					RawQuery: parsedTarget.RawQuery,
-				}
+				nextUrl := response.Request.URL.ResolveReference(parsedTarget)
+				response.Body.Close()
 
-				return requestWrapper(method, nextUrl.String(), allowRedirects, true, headers)
+				return client.requestWrapper(ctx, method, nextUrl.String(), allowRedirects, true, headers, body)
 			}
 		}
+
+		return response, nil
 	}
 
-	var (
-		response *http.Response
-		err      error = nil
-	)
+	// Only the idempotent requests are retried, since the others may have been applied before failing
+	retryable := method == http.MethodGet || method == http.MethodHead || method == http.MethodPut
+	policy := client.retryPolicy()
+	for failures := 0; ; failures++ {
+		response, err := client.doRequest(ctx, method, rawUrl, allowRedirects, headers, body)
+		if err == nil && !(retryable && policy.isRetryableStatus(response.StatusCode)) {
+			return response, nil
+		}
+		if !retryable || (isConnectionError(err) && ctx.Value(noConnectionRetriesKey{}) != nil) {
+			return nil, err
+		}
+
+		if err == nil {
+			err = hfRaiseForStatus(response)
+			response.Body.Close()
+		}
+		if err := policy.retry(ctx, failures, err, fmt.Sprintf("%s %s", method, rawUrl)); err != nil {
+			return nil, err
+		}
+	}
+}
 
-	request, err := http.NewRequest(method, rawUrl, nil)
+func (client *Client) doRequest(ctx context.Context, method, rawUrl string, allowRedirects bool, headers *http.Header, body io.ReadSeeker) (*http.Response, error) {
+	request, err := http.NewRequestWithContext(ctx, method, rawUrl, nil)
 	if err != nil {
 		return nil, err
 	}
 
-	client := &http.Client{}
-	if !allowRedirects {
-		client.CheckRedirect = func(req *http.Request, via []*http.Request) error {
-			return http.ErrUseLastResponse
+	if headers != nil {
+		request.Header = *headers
+	}
+
+	if body != nil {
+		// The body is rewound before each attempt, so that redirected or retried requests send it entirely
+		request.ContentLength, err = body.Seek(0, io.SeekEnd)
+		if err != nil {
+			return nil, err
+		}
+
+		request.GetBody = func() (io.ReadCloser, error) {
+			if request.ContentLength == 0 {
+				return http.NoBody, nil
+			}
+			if _, err := body.Seek(0, io.SeekStart); err != nil {
+				return nil, err
+			}
+			return io.NopCloser(body), nil
+		}
+
+		request.Body, err = request.GetBody()
+		if err != nil {
+			return nil, err
 		}
 	}
 
-	if headers != nil {
-		request.Header = *headers
+	return client.httpClient(allowRedirects).Do(request)
+}
+
+// buildHeaders returns the headers sent with every request to the Hub.
+// The Authorization header is only set when the client has a token.
+func (client *Client) buildHeaders() *http.Header {
+	userAgent := client.UserAgent
+	if userAgent == "" {
+		userAgent = DefaultUserAgent
 	}
 
-	response, err = client.Do(request)
-	if err != nil {
-		return nil, err
+	headers := &http.Header{}
+	headers.Set("User-Agent", userAgent)
+	if client.Token != "" {
+		headers.Set("Authorization", fmt.Sprintf("Bearer %s", client.Token))
+	}
+
+	return headers
+}
+
+// httpClient returns the http.Client used for every request made by the client.
+// The underlying transport (and thus its connection pool) is shared, only the redirect policy differs per request.
+func (client *Client) httpClient(allowRedirects bool) *http.Client {
+	httpClient := client.HTTPClient
+	if httpClient == nil {
+		httpClient = defaultHTTPClient
+	}
+
+	if allowRedirects {
+		return httpClient
 	}
 
-	return response, nil
+	noRedirectClient := *httpClient
+	noRedirectClient.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+	return &noRedirectClient
 }
 
-func downloadToTmpAndMove(incompletePath, destinationPath, downloadUrl string, headers *http.Header, expectedSize int, filename string, forceDownload bool) error {
-	if _, err := os.Stat(destinationPath); err == nil && !forceDownload {
+// downloadToTmpAndMove downloads a file to incompletePath, resuming a previous download if there is one, then moves
+// it to destinationPath. The content is verified against the ETag when it is a sha256 (LFS files) or a git blob
+// sha1 (regular files), and the file isn't moved on a mismatch.
+func downloadToTmpAndMove(ctx context.Context, client *Client, incompletePath, destinationPath, downloadUrl string, headers *http.Header, expectedSize int, etag string, repoId string, filename string, forceDownload bool, limiter *RateLimiter) error {
+	if info, err := os.Stat(destinationPath); err == nil && !forceDownload {
 		// Do nothing if already exists (except if force_download=True)
+		client.progressReporter().FileCached(repoId, filename, info.Size())
 		return nil
 	}
 
-	_, err := os.Stat(incompletePath)
-	if err == nil {
+	incompleteInfo, err := os.Stat(incompletePath)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	if err == nil && forceDownload {
 		// By default, we will try to resume the download if possible.
 		// However, if the user has set `force_download=True`, we should not resume the download => delete the incomplete file.
-		message := fmt.Sprintf("Removing incomplete file '%s'", incompletePath)
-		if forceDownload {
-			message += " (force_download=True)"
-		}
+		log.Printf("Removing incomplete file '%s' (force_download=True)\n", incompletePath)
+		os.Remove(incompletePath)
+		os.Remove(rangesPath(incompletePath))
+		incompleteInfo = nil
+	}
 
-		log.Println(message)
+	parallel := client.canDownloadInParallel(incompletePath, int64(expectedSize))
+	if _, err := os.Stat(rangesPath(incompletePath)); err == nil && !parallel {
+		// A parallel download preallocates the whole file, so it can't be resumed over a single connection
+		log.Printf("Removing incomplete file '%s' of a parallel download\n", incompletePath)
 		os.Remove(incompletePath)
+		os.Remove(rangesPath(incompletePath))
+		incompleteInfo = nil
 	}
 
-	if err != nil && !errors.Is(err, os.ErrNotExist) {
-		return err
-	} else {
-		if forceDownload {
-			message := fmt.Sprintf("Removing incomplete file '%s'", incompletePath)
-			if forceDownload {
-				message += " (force_download=True)"
+	message := fmt.Sprintf("Downloading '%s' to '%s'", filename, incompletePath)
+	if incompleteInfo != nil && !parallel && expectedSize != 0 {
+		message += fmt.Sprintf(" (resume from %d/%d)", incompleteInfo.Size(), expectedSize)
+	}
+	log.Println(message)
+
+	if expectedSize != 0 {
+		// Check disk space in both tmp and destination path
+		checkDiskSpace := func(dir string) error {
+			size, err := utils.GetAvailableDiskSpace(dir)
+			if err != nil {
+				return err
 			}
 
-			log.Println(message)
+			if size < uint64(expectedSize) {
+				return fmt.Errorf("not enough free disk space to download the file. The expected file size is: %d MB. The target location %s only has %d MB free disk space", expectedSize/1000000, dir, size/1000000)
+			}
+			return nil
+		}
+
+		if err := checkDiskSpace(filepath.Dir(incompletePath)); err != nil {
+			return err
+		}
+		if err := checkDiskSpace(filepath.Dir(destinationPath)); err != nil {
+			return err
+		}
+	}
+
+	hasher := blobHasher(etag, int64(expectedSize))
+	if parallel {
+		err = downloadFileParallel(ctx, client, downloadUrl, incompletePath, headers, int64(expectedSize), repoId, filename, limiter)
+		if errors.Is(err, errRangeNotSupported) {
+			log.Printf("%s, downloading '%s' over a single connection\n", err, filename)
 			os.Remove(incompletePath)
+			os.Remove(rangesPath(incompletePath))
+			parallel = false
+		} else if err == nil && hasher != nil {
+			// The chunks are written out of order, so the file is hashed once complete
+			err = hashFilePrefix(hasher, incompletePath, int64(expectedSize))
+		}
+	}
+	if !parallel {
+		err = downloadFileSingleStream(ctx, client, downloadUrl, incompletePath, headers, int64(expectedSize), repoId, filename, hasher, limiter)
+	}
+
+	if err == nil && hasher != nil {
+		if actual := hex.EncodeToString(hasher.Sum(nil)); actual != etag {
+			// The content is corrupted, so it must not be resumed by the next download
+			os.Remove(incompletePath)
+			os.Remove(rangesPath(incompletePath))
+			err = fmt.Errorf("%w: %s should have the hash %s but has %s. Please retry the download", ErrChecksumMismatch, filename, etag, actual)
 		}
 	}
 
-	incompleteFile, err := os.OpenFile(incompletePath, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
 	if err != nil {
 		return err
 	}
+	if err := os.Rename(incompletePath, destinationPath); err != nil {
+		return err
+	}
+
+	client.progressReporter().FileFinished(repoId, filename)
+	return nil
+}
 
+// downloadFileSingleStream downloads a file over a single connection, resuming from the end of the incomplete file.
+func downloadFileSingleStream(ctx context.Context, client *Client, downloadUrl string, incompletePath string, headers *http.Header, expectedSize int64, repoId string, filename string, hasher hash.Hash, limiter *RateLimiter) error {
+	incompleteFile, err := os.OpenFile(incompletePath, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
 	defer incompleteFile.Close()
 
 	resumeSize, err := incompleteFile.Seek(0, io.SeekEnd)
 	if err != nil {
 		return err
 	}
-	message := fmt.Sprintf("Downloading '%s' to '%s'", filename, incompletePath)
-	if resumeSize > 0 && expectedSize != 0 {
-		message += fmt.Sprintf(" (resume from %d/%d)", resumeSize, expectedSize)
-	}
-	log.Println(message)
 
-	if expectedSize != 0 {
-		// Check disk space in both tmp and destination path
-		incompletePathDir := filepath.Dir(incompletePath)
-		size, err := utils.GetAvailableDiskSpace(incompletePathDir)
-		if err != nil {
+	if hasher != nil && resumeSize > 0 {
+		// The resumed bytes are part of the content to verify
+		if err := hashFilePrefix(hasher, incompletePath, resumeSize); err != nil {
 			return err
 		}
-		if expectedSize > 0 && size < uint64(expectedSize) {
-			return fmt.Errorf("not enough free disk space to download the file. The expected file size is: %d MB. The target location %s only has %d MB free disk space", expectedSize/1000000, incompletePathDir, size/1000000)
-		}
+	}
 
-		destinationPathDir := filepath.Dir(destinationPath)
-		size, err = utils.GetAvailableDiskSpace(destinationPathDir)
-		if err != nil {
-			return err
-		}
+	err = downloadFileStream(ctx, client, downloadUrl, incompleteFile, resumeSize, headers, expectedSize, repoId, filename, hasher, limiter)
+	if err != nil {
+		return err
+	}
+	return incompleteFile.Close()
+}
 
-		if expectedSize > 0 && size < uint64(expectedSize) {
-			return fmt.Errorf("not enough free disk space to download the file. The expected file size is: %d MB. The target location %s only has %d MB free disk space", expectedSize/1000000, destinationPathDir, size/10666)
-		}
+// reportCachedFile reports a file that didn't need to be downloaded, with the size of the file at path.
+func reportCachedFile(client *Client, repoId string, fileName string, path string) {
+	var size int64
+	if info, err := os.Stat(path); err == nil {
+		size = info.Size()
+	}
+	client.progressReporter().FileCached(repoId, fileName, size)
+}
+
+// blobHasher returns the hash to verify the content of a file against its ETag: the sha256 of LFS files, or the
+// git blob sha1 of regular files. It returns nil when the ETag is neither, in which case the content isn't verified.
+func blobHasher(etag string, size int64) hash.Hash {
+	switch {
+	case regexp.MustCompile(Sha256Pattern).MatchString(etag):
+		return sha256.New()
+	// git object ids have the same format as commit hashes
+	case regexp.MustCompile(CommitHashPattern).MatchString(etag):
+		hasher := &gitBlobHash{Hash: sha1.New(), header: fmt.Sprintf("blob %d\x00", size)}
+		hasher.Reset()
+		return hasher
 	}
+	return nil
+}
 
-	err = downloadFileStream(downloadUrl, incompleteFile, resumeSize, headers, int64(expectedSize), filename, DefaultRetries)
+// gitBlobHash computes the git object id of a blob, the sha1 of its content prefixed with a header. Reset writes
+// the header again, so that a download starting over is still hashed as a blob.
+type gitBlobHash struct {
+	hash.Hash
+	header string
+}
 
+func (h *gitBlobHash) Reset() {
+	h.Hash.Reset()
+	h.Hash.Write([]byte(h.header))
+}
+
+// hashFilePrefix writes the first n bytes of the file at path to hasher.
+func hashFilePrefix(hasher hash.Hash, path string, n int64) error {
+	file, err := os.Open(path)
 	if err != nil {
 		return err
 	}
+	defer file.Close()
 
-	os.Rename(incompletePath, destinationPath)
-	return nil
+	_, err = io.CopyN(hasher, file, n)
+	return err
 }
 
 func repoFolderName(repoId string, repoType string) string {
@@ -288,37 +472,51 @@ func repoFolderName(repoId string, repoType string) string {
 }
 
 func cacheCommitHashForSpecificRevision(storageFolder string, revision string, commitHash string) error {
-	if revision != commitHash {
-		refPath := filepath.Join(storageFolder, "refs", revision)
-		err := os.MkdirAll(filepath.Dir(refPath), os.ModePerm)
-		if err != nil {
-			panic(err)
-		}
+	if revision == commitHash {
+		return nil
+	}
 
-		_, err = os.Stat(refPath)
-		if err != nil {
-			if errors.Is(err, os.ErrNotExist) {
-				os.WriteFile(refPath, []byte(commitHash), os.ModePerm)
-			}
+	refPath := filepath.Join(storageFolder, "refs", revision)
+	err := os.MkdirAll(filepath.Dir(refPath), os.ModePerm)
+	if err != nil {
+		return err
+	}
 
-			return err
-		}
+	content, err := os.ReadFile(refPath)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
 
-		file, err := os.ReadFile(refPath)
+	if string(content) != commitHash {
+		return os.WriteFile(refPath, []byte(commitHash), os.ModePerm)
+	}
+	return nil
+}
+
+// cachedPointerPath returns the path of a file in the cached snapshot of a revision, without any network call.
+// Branch and tag names are resolved to a commit hash through the refs folder.
+// The returned error wraps os.ErrNotExist when the revision or the file isn't cached.
+func cachedPointerPath(storageFolder string, revision string, fileName string) (string, error) {
+	commitHash := revision
+	if !regexp.MustCompile(CommitHashPattern).MatchString(revision) {
+		content, err := os.ReadFile(filepath.Join(storageFolder, "refs", revision))
 		if err != nil {
-			return err
-		}
-		if string(file) != commitHash {
-			os.WriteFile(refPath, []byte(commitHash), os.ModePerm)
+			return "", err
 		}
+		commitHash = string(content)
+	}
 
-		return nil
+	pointerPath := filepath.Join(storageFolder, "snapshots", commitHash, fileName)
+	if _, err := os.Stat(pointerPath); err != nil {
+		return "", err
 	}
-	return nil
 
+	return pointerPath, nil
 }
 
-func fileDownload(client *Client, params *DownloadParams) (string, error) {
+// fileDownload downloads a single file to the cache, or to params.LocalDir. When pruneCache is set, the cache is
+// pruned to make room for the file beforehand, which snapshot downloads do once for all their files instead.
+func fileDownload(ctx context.Context, client *Client, params *DownloadParams, pruneCache bool) (path string, err error) {
 	repoId := params.Repo.Id
 	fileName := params.FileName
 	repoType := params.Repo.Type
@@ -328,13 +526,32 @@ func fileDownload(client *Client, params *DownloadParams) (string, error) {
 		fileName = fmt.Sprintf("%s/%s", params.SubFolder, fileName)
 	}
 
-	if repoType != SpaceRepoType && repoType != DatasetRepoType && repoType != ModelRepoType {
+	// Every error is a failure of the file, whether it happens before or during its download
+	defer func() {
+		if err != nil {
+			client.progressReporter().FileFailed(repoId, fileName, err)
+		}
+	}()
+
+	if !isValidRepoType(repoType) {
 		return "", fmt.Errorf("invalid repo type: %s", repoType)
 	}
 
+	if params.LocalDir != "" {
+		return fileDownloadToLocalDir(ctx, client, params, fileName)
+	}
+
+	// downloadToTmpAndMove reports the progress of the file, which is otherwise already up to date
+	progressReported := false
+	defer func() {
+		if err == nil && !progressReported {
+			reportCachedFile(client, repoId, fileName, path)
+		}
+	}()
+
 	repoFolderName := repoFolderName(repoId, repoType)
 	storageFolder := filepath.Join(client.CacheDir, repoFolderName)
-	err := os.MkdirAll(storageFolder, os.ModePerm)
+	err = os.MkdirAll(storageFolder, os.ModePerm)
 	if err != nil {
 		return "", err
 	}
@@ -342,42 +559,54 @@ func fileDownload(client *Client, params *DownloadParams) (string, error) {
 	snapshotPath := filepath.Join(storageFolder, "snapshots")
 
 	revision := params.Revision
-	if regexp.MustCompile(CommitHashPattern).MatchString(revision) {
+	if regexp.MustCompile(CommitHashPattern).MatchString(revision) && !forceDownload {
 		pointerPath := filepath.Join(snapshotPath, revision, fileName)
 		_, err := os.Stat(pointerPath)
-		if err == nil && !forceDownload {
+		if err == nil {
 			return pointerPath, nil
-		} else {
-			if !errors.Is(err, os.ErrNotExist) {
-				return "", err
+		}
+		if !errors.Is(err, os.ErrNotExist) {
+			return "", err
+		}
+	}
+
+	if params.LocalFilesOnly || IsOffline {
+		pointerPath, err := cachedPointerPath(storageFolder, revision, fileName)
+		if errors.Is(err, os.ErrNotExist) {
+			return "", &LocalEntryNotFoundError{
+				Message: "cannot find the requested file in the disk cache and outgoing traffic has been disabled. To enable look-ups and downloads online, set LocalFilesOnly to false and unset HF_HUB_OFFLINE",
 			}
 		}
+		return pointerPath, err
 	}
 
-	headers := &http.Header{}
-	headers.Set("User-Aget", client.UserAgent)
-	headers.Set("Authorization", fmt.Sprintf("Bearer %s", client.Token))
+	headers := client.buildHeaders()
 
-	urlParams := map[string]string{
-		"Endpoint": client.Endpoint,
-		"RepoId":   repoId,
-		"Revision": revision,
-		"Filename": fileName,
-	}
-	hfResolveUrl, err := formatUrl(hfResolveUrlTemplate, urlParams)
+	hfResolveUrl := client.FileURL(params.Repo, fileName, revision)
+	fileMetadata, err := client.getFileMetadata(ctx, hfResolveUrl, headers)
 	if err != nil {
-		return "", err
-	}
+		// We're offline, so we fall back to the cached version of the file if there is one
+		if isOfflineError(err) {
+			pointerPath, cacheErr := cachedPointerPath(storageFolder, revision, fileName)
+			if cacheErr == nil {
+				return pointerPath, nil
+			}
 
-	fileMetadata, err := getFileMetadata(hfResolveUrl, headers)
-	if err != nil {
-		if strings.Contains(err.Error(), "EntryNotFound") {
+			return "", &LocalEntryNotFoundError{
+				Message: "an error happened while trying to locate the file on the Hub and we cannot find the requested file in the local cache. Please check your internet connection and try again",
+				Err:     err,
+			}
+		}
+
+		var entryNotFoundErr *EntryNotFoundError
+		if errors.As(err, &entryNotFoundErr) {
 			if fileMetadata != nil && fileMetadata.CommitHash != "" {
-				noExistPath := filepath.Join(storageFolder, ".no_exist", fileMetadata.CommitHash)
-				os.MkdirAll(noExistPath, os.ModePerm)
+				noExistFilePath := filepath.Join(storageFolder, ".no_exist", fileMetadata.CommitHash, fileName)
+				os.MkdirAll(filepath.Dir(noExistFilePath), os.ModePerm)
 
-				noExistFilePath := filepath.Join(noExistPath, fileName)
-				os.Create(noExistFilePath)
+				if noExistFile, err := os.Create(noExistFilePath); err == nil {
+					noExistFile.Close()
+				}
 				cacheCommitHashForSpecificRevision(storageFolder, revision, fileMetadata.CommitHash)
 			}
 		}
@@ -397,10 +626,6 @@ func fileDownload(client *Client, params *DownloadParams) (string, error) {
 		return "", fmt.Errorf("no ETag found for this file. It is likely that the file is not yet available on HF Hub")
 	}
 
-	if fileMetadata.Size == 0 {
-		return "", fmt.Errorf("no size found for this file. It is likely that the file is not yet available on HF Hub")
-	}
-
 	if !(params.LocalFilesOnly || fileMetadata.ETag != "") {
 		return "", fmt.Errorf("error while retrieving file metadata: %s", err)
 	}
@@ -441,6 +666,11 @@ func fileDownload(client *Client, params *DownloadParams) (string, error) {
 	blobPath := filepath.Join(storageFolder, "blobs", fileMetadata.ETag)
 	pointerPath := filepath.Join(snapshotPath, commitHash, fileName)
 
+	// The cache is pruned before the snapshot folder and the ref are written, and never evicts this revision
+	if _, err := os.Stat(blobPath); pruneCache && (err != nil || forceDownload) {
+		client.makeRoomInCache(int64(fileMetadata.Size), &cachedRevisionKey{repoFolderName, commitHash})
+	}
+
 	os.MkdirAll(filepath.Dir(blobPath), os.ModePerm)
 	os.MkdirAll(filepath.Dir(pointerPath), os.ModePerm)
 
@@ -457,7 +687,9 @@ func fileDownload(client *Client, params *DownloadParams) (string, error) {
 
 		_, err := os.Stat(blobPath)
 		if err == nil {
-			createSymlink(blobPath, pointerPath, false)
+			if err := createSymlink(blobPath, pointerPath, false); err != nil {
+				return "", err
+			}
 			return pointerPath, nil
 		} else {
 			if !errors.Is(err, os.ErrNotExist) {
@@ -476,47 +708,78 @@ func fileDownload(client *Client, params *DownloadParams) (string, error) {
 		return "", err
 	}
 
-	lockPath := filepath.Join(lockFolder, fmt.Sprintf("%s.lock", fileMetadata.ETag))
-	lock := flock.New(lockPath)
-	locked, err := lock.TryLock()
+	lock, err := lockFile(ctx, filepath.Join(lockFolder, fmt.Sprintf("%s.lock", fileMetadata.ETag)))
 	if err != nil {
 		return "", err
 	}
-
-	if !locked {
-		return "", fmt.Errorf("failed to acquire lock for %s", fileMetadata.ETag)
-	}
-
 	defer lock.Unlock()
 
-	err = downloadToTmpAndMove(incompletePath, destinationPath, hfResolveUrl, headers, fileMetadata.Size, fileName, forceDownload)
+	progressReported = true
+	err = downloadToTmpAndMove(ctx, client, incompletePath, destinationPath, hfResolveUrl, headers, fileMetadata.Size, fileMetadata.ETag, repoId, fileName, forceDownload, client.rateLimiter(params))
 	if err != nil {
 		return "", err
 	}
 
-	createSymlink(destinationPath, pointerPath, true)
+	if err := createSymlink(destinationPath, pointerPath, true); err != nil {
+		return "", err
+	}
 	return pointerPath, nil
 }
 
-func getFileMetadata(url string, headers *http.Header) (*FileMetadata, error) {
-	headers.Set("Accept-Encoding", "identity")
-	response, err := requestWrapper("HEAD", url, false, true, headers)
+// FileURL returns the URL to download a file of a repo at a revision (defaults to repo.Revision, then the main branch).
+// The path and the revision are escaped, so revisions like `refs/pr/3` are supported.
+func (client *Client) FileURL(repo *Repo, pathInRepo string, revision string) string {
+	params := client.repoUrlParams(repo, revision)
+	params["Filename"] = escapePathInRepo(cleanPathInRepo(pathInRepo))
 
-	if response.StatusCode >= 400 {
-		m := &FileMetadata{
-			CommitHash: response.Header.Get("X-Repo-Commit"),
-		}
+	// The template is a constant, so it can't fail to execute
+	fileUrl, _ := formatUrl(hfResolveUrlTemplate, params)
+	return fileUrl
+}
+
+// GetFileMetadata fetches the commit hash, ETag and size of a file of the repo at repo.Revision, without downloading it.
+func (client *Client) GetFileMetadata(ctx context.Context, repo *Repo, pathInRepo string) (*FileMetadata, error) {
+	if _, err := validateRepoType(repo); err != nil {
+		return nil, err
+	}
+
+	metadata, err := client.getFileMetadata(ctx, client.FileURL(repo, pathInRepo, ""), client.buildHeaders())
+	if err != nil {
+		return nil, err
+	}
+	return metadata, nil
+}
 
-		errorCode := response.Header.Get("X-Error-Code")
-		errorTemplate := "error while retrieving file metadata from %s due to %s"
-		return m, fmt.Errorf(errorTemplate, url, errorCode)
+// lockFile acquires the file lock at lockPath, waiting for the process holding it until ctx is done.
+func lockFile(ctx context.Context, lockPath string) (*flock.Flock, error) {
+	lock := flock.New(lockPath)
+	locked, err := lock.TryLockContext(ctx, 500*time.Millisecond)
+	if err != nil {
+		return nil, err
+	}
+
+	if !locked {
+		return nil, fmt.Errorf("failed to acquire lock %s", lockPath)
 	}
+	return lock, nil
+}
 
+func (client *Client) getFileMetadata(ctx context.Context, url string, headers *http.Header) (*FileMetadata, error) {
+	headers.Set("Accept-Encoding", "identity")
+	response, err := client.requestWrapper(withoutConnectionRetries(ctx), "HEAD", url, false, true, headers, nil)
 	if err != nil {
 		return nil, err
 	}
 	defer response.Body.Close()
 
+	if err := hfRaiseForStatus(response); err != nil {
+		m := &FileMetadata{
+			CommitHash: response.Header.Get("X-Repo-Commit"),
+		}
+
+		return m, err
+	}
+
 	commitHash := response.Header.Get("X-Repo-Commit")
 
 	etag := response.Header.Get("X-Linked-Etag")
@@ -529,9 +792,10 @@ func getFileMetadata(url string, headers *http.Header) (*FileMetadata, error) {
 		sizeStr = response.Header.Get("Content-Length")
 	}
 
+	// empty files are valid, only a missing size is an error
 	size, err := strconv.Atoi(sizeStr)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("no size found for this file. It is likely that the file is not yet available on HF Hub")
 	}
 
 	location := response.Header.Get("Location")
@@ -0,0 +1,113 @@
+package hub
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func gitBlobSha1(content string) string {
+	sum := sha1.Sum([]byte(fmt.Sprintf("blob %d\x00%s", len(content), content)))
+	return hex.EncodeToString(sum[:])
+}
+
+// downloadTestFile downloads url with downloadToTmpAndMove to a new folder, and returns the destination path.
+func downloadTestFile(t *testing.T, client *Client, url string, size int, etag string) (string, error) {
+	t.Helper()
+
+	destinationPath := filepath.Join(t.TempDir(), "file")
+	return destinationPath, downloadToTmpAndMove(context.Background(), client, destinationPath+".incomplete", destinationPath, url, &http.Header{}, size, etag, "org/repo", "file", false, nil)
+}
+
+func assertFileContent(t *testing.T, path string, want string) {
+	t.Helper()
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(content) != want {
+		t.Errorf("%s contains %q, want %q", path, content, want)
+	}
+}
+
+func TestDownloadVerifiesHash(t *testing.T) {
+	content := strings.Repeat("content ", 100)
+
+	tests := []struct {
+		name    string
+		etag    string
+		wantErr bool
+	}{
+		{"LFS file", sha256Hex(content), false},
+		{"regular file", gitBlobSha1(content), false},
+		{"unknown ETag format", "W/abc", false},
+		{"corrupted LFS file", sha256Hex("other content"), true},
+		{"corrupted regular file", gitBlobSha1("other content"), true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				serveTestFile(w, r, content, test.etag)
+			}))
+			defer server.Close()
+
+			path, err := downloadTestFile(t, newTestClient(t, server, nil), server.URL, len(content), test.etag)
+			if !test.wantErr {
+				if err != nil {
+					t.Fatal(err)
+				}
+				assertFileContent(t, path, content)
+				return
+			}
+
+			if !errors.Is(err, ErrChecksumMismatch) {
+				t.Fatalf("err = %v, want %v", err, ErrChecksumMismatch)
+			}
+			// The corrupted content must not be resumed by the next download
+			assertExists(t, path, false)
+			assertExists(t, path+".incomplete", false)
+		})
+	}
+}
+
+func TestDownloadVerifiesHashWhenStartingOver(t *testing.T) {
+	content := "the content of a regular file"
+
+	// The server ignores the range of the resumed download and sends the whole file
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.Header.Del("Range")
+		serveTestFile(w, r, content, gitBlobSha1(content))
+	}))
+	defer server.Close()
+
+	destinationPath := filepath.Join(t.TempDir(), "file")
+	if err := os.WriteFile(destinationPath+".incomplete", []byte("partial"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	err := downloadToTmpAndMove(context.Background(), newTestClient(t, server, nil), destinationPath+".incomplete", destinationPath, server.URL, &http.Header{}, len(content), gitBlobSha1(content), "org/repo", "file", false, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertFileContent(t, destinationPath, content)
+}
+
+func TestDownloadEmptyFile(t *testing.T) {
+	server := newTestServer(t, map[string]string{"__init__.py": ""})
+
+	path, err := newTestClient(t, server, nil).Download(&DownloadParams{Repo: NewRepo("org/repo"), FileName: "__init__.py"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertFileContent(t, path, "")
+}
@@ -0,0 +1,175 @@
+package hub
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// apiRequest sends a request to the Hub API and decodes its JSON response into result, unless result is nil.
+// body is sent as JSON unless it is nil. headers default to the client headers when nil.
+func (client *Client) apiRequest(ctx context.Context, method string, apiUrl string, headers *http.Header, body any, result any) (*http.Response, error) {
+	if headers == nil {
+		headers = client.buildHeaders()
+	}
+
+	var bodyReader io.ReadSeeker
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+
+		bodyReader = bytes.NewReader(data)
+		if headers.Get("Content-Type") == "" {
+			headers.Set("Content-Type", "application/json")
+		}
+	}
+
+	response, err := client.requestWrapper(ctx, method, apiUrl, true, true, headers, bodyReader)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	if err := hfRaiseForStatus(response); err != nil {
+		return response, err
+	}
+
+	if result != nil {
+		if err := json.NewDecoder(response.Body).Decode(result); err != nil {
+			return response, err
+		}
+	}
+
+	return response, nil
+}
+
+// repoUrlParams returns the parameters of the URL templates for a repo at a given revision.
+// The revision is escaped, since branch names like `refs/pr/1` contain slashes.
+func (client *Client) repoUrlParams(repo *Repo, revision string) map[string]string {
+	repoType := repo.Type
+	if repoType == "" {
+		repoType = ModelRepoType
+	}
+
+	if revision == "" {
+		revision = repo.Revision
+	}
+	if revision == "" {
+		revision = DefaultRevision
+	}
+
+	return map[string]string{
+		"Endpoint":   client.Endpoint,
+		"RepoType":   repoType,
+		"RepoPrefix": RepoTypesUrlPrefixes[repoType],
+		"RepoId":     repo.Id,
+		"Revision":   url.PathEscape(revision),
+	}
+}
+
+// escapePathInRepo escapes each segment of a path in the repo, keeping the `/` separators.
+func escapePathInRepo(pathInRepo string) string {
+	segments := strings.Split(pathInRepo, "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	return strings.Join(segments, "/")
+}
+
+// Iterator iterates over the items of a paginated Hub API endpoint, fetching the pages as they are needed.
+// It follows the `Link: <url>; rel="next"` header of each page.
+//
+// example:
+//
+//	for it.Next() {
+//		item := it.Value()
+//	}
+//	if err := it.Err(); err != nil {
+//		...
+//	}
+type Iterator[T any] struct {
+	ctx     context.Context
+	client  *Client
+	nextUrl string
+	// limit is the maximum number of items to return, or 0 for all of them.
+	limit int
+	count int
+	page  []T
+	value T
+	err   error
+}
+
+func newIterator[T any](ctx context.Context, client *Client, firstUrl string, limit int) *Iterator[T] {
+	return &Iterator[T]{
+		ctx:     ctx,
+		client:  client,
+		nextUrl: firstUrl,
+		limit:   limit,
+	}
+}
+
+// Next advances to the next item, which is then available with Value. It returns false when
+// there are no more items or when an error occurred, which is then returned by Err.
+func (it *Iterator[T]) Next() bool {
+	if it.err != nil || (it.limit > 0 && it.count >= it.limit) {
+		return false
+	}
+
+	for len(it.page) == 0 {
+		if it.nextUrl == "" {
+			return false
+		}
+
+		var page []T
+		response, err := it.client.apiRequest(it.ctx, "GET", it.nextUrl, nil, nil, &page)
+		if err != nil {
+			it.err = err
+			return false
+		}
+
+		it.page = page
+		it.nextUrl = nextPageUrl(response.Header)
+	}
+
+	it.value = it.page[0]
+	it.page = it.page[1:]
+	it.count++
+	return true
+}
+
+// Value returns the current item.
+func (it *Iterator[T]) Value() T {
+	return it.value
+}
+
+// Err returns the error that stopped the iteration, if any.
+func (it *Iterator[T]) Err() error {
+	return it.err
+}
+
+// nextPageUrl returns the URL of the `rel="next"` link of a Link header, or "" if there isn't one.
+func nextPageUrl(header http.Header) string {
+	for _, value := range header.Values("Link") {
+		for _, link := range strings.Split(value, ",") {
+			parts := strings.Split(link, ";")
+			target := strings.TrimSpace(parts[0])
+			if !strings.HasPrefix(target, "<") || !strings.HasSuffix(target, ">") {
+				continue
+			}
+
+			for _, param := range parts[1:] {
+				key, value, _ := strings.Cut(strings.TrimSpace(param), "=")
+				if strings.TrimSpace(key) == "rel" && strings.Trim(strings.TrimSpace(value), `"`) == "next" {
+					return target[1 : len(target)-1]
+				}
+			}
+		}
+	}
+	return ""
+}
@@ -1,17 +1,36 @@
 package hub
 
 import (
+	"context"
 	"fmt"
+	"net/http"
 	"os"
 	"path/filepath"
 	"strconv"
+	"sync"
 )
 
 type Client struct {
-	Endpoint  string
-	Token     string
-	CacheDir  string
-	UserAgent string
+	Endpoint   string
+	Token      string
+	CacheDir   string
+	UserAgent  string
+	HTTPClient *http.Client
+	// MaxWorkers is the number of files downloaded concurrently by a snapshot download.
+	MaxWorkers int
+	// ProgressReporter receives the download progress. Defaults to progress bars drawn on stderr.
+	ProgressReporter ProgressReporter
+	// MaxCacheSize, when set, keeps the cache under this many bytes by evicting the least recently used
+	// revisions before each download. They are also evicted when the disk is too full for a download.
+	MaxCacheSize int64
+	// ParallelConnections, when above 1, downloads the files larger than ParallelChunkSize over this many
+	// connections, each fetching chunks of ParallelChunkSize bytes (DefaultParallelChunkSize when unset).
+	ParallelConnections int
+	ParallelChunkSize   int64
+	// RetryPolicy configures how failed requests and interrupted downloads are retried. Defaults to DefaultRetryPolicy.
+	RetryPolicy *RetryPolicy
+	// RateLimiter, when set, limits the total bandwidth of the downloads of the client.
+	RateLimiter *RateLimiter
 }
 
 type Repo struct {
@@ -20,6 +39,8 @@ type Repo struct {
 	Revision string
 }
 
+// FileMetadata describes a file of a repo, as returned by GetFileMetadata. Location is the URL the file
+// is downloaded from, which may be a CDN.
 type FileMetadata struct {
 	CommitHash string
 	ETag       string
@@ -27,15 +48,6 @@ type FileMetadata struct {
 	Size       int
 }
 
-type ModelInfo struct {
-	Sha      string             `json:"sha"`
-	Siblings []ModelInfoSibling `json:"siblings"`
-}
-
-type ModelInfoSibling struct {
-	RFileName string `json:"rfilename"`
-}
-
 const (
 	DefaultRevision  = "main"
 	DefaultCacheDir  = "~/.cache/huggingface/hub"
@@ -49,23 +61,42 @@ const (
 )
 
 const (
-	defaultHfEndpoint           = "https://huggingface.co"
-	defaultHfStagingEndpoint    = "https://hub-ci.huggingface.co"
-	hfResolveUrlTemplate        = "{{.Endpoint}}/{{.RepoId}}/resolve/{{.Revision}}/{{.Filename}}"
-	hfModelInfoTemplate         = "{{.Endpoint}}/api/models/{{.RepoId}}"
-	hfModelRevisionInfoTemplate = "{{.Endpoint}}/api/models/{{.RepoId}}/revision/{{.Revision}}"
+	defaultHfEndpoint          = "https://huggingface.co"
+	defaultHfStagingEndpoint   = "https://hub-ci.huggingface.co"
+	hfResolveUrlTemplate       = "{{.Endpoint}}/{{.RepoPrefix}}{{.RepoId}}/resolve/{{.Revision}}/{{.Filename}}"
+	hfListModelsTemplate       = "{{.Endpoint}}/api/models"
+	hfRepoInfoTemplate         = "{{.Endpoint}}/api/{{.RepoType}}s/{{.RepoId}}"
+	hfRepoRevisionInfoTemplate = "{{.Endpoint}}/api/{{.RepoType}}s/{{.RepoId}}/revision/{{.Revision}}"
+	hfPreuploadTemplate        = "{{.Endpoint}}/api/{{.RepoType}}s/{{.RepoId}}/preupload/{{.Revision}}"
+	hfCommitTemplate           = "{{.Endpoint}}/api/{{.RepoType}}s/{{.RepoId}}/commit/{{.Revision}}"
+	hfRepoTreeTemplate         = "{{.Endpoint}}/api/{{.RepoType}}s/{{.RepoId}}/tree/{{.Revision}}{{.Path}}"
+	hfRepoRefsTemplate         = "{{.Endpoint}}/api/{{.RepoType}}s/{{.RepoId}}/refs"
+	hfRepoCommitsTemplate      = "{{.Endpoint}}/api/{{.RepoType}}s/{{.RepoId}}/commits/{{.Revision}}"
+	hfBranchTemplate           = "{{.Endpoint}}/api/{{.RepoType}}s/{{.RepoId}}/branch/{{.Ref}}"
+	hfTagTemplate              = "{{.Endpoint}}/api/{{.RepoType}}s/{{.RepoId}}/tag/{{.Ref}}"
+	hfPathsInfoTemplate        = "{{.Endpoint}}/api/{{.RepoType}}s/{{.RepoId}}/paths-info/{{.Revision}}"
+	hfLfsBatchTemplate         = "{{.Endpoint}}/{{.RepoPrefix}}{{.RepoId}}.git/info/lfs/objects/batch"
+	hfCreateRepoTemplate       = "{{.Endpoint}}/api/repos/create"
+	hfDeleteRepoTemplate       = "{{.Endpoint}}/api/repos/delete"
+	hfMoveRepoTemplate         = "{{.Endpoint}}/api/repos/move"
+	hfRepoSettingsTemplate     = "{{.Endpoint}}/api/{{.RepoType}}s/{{.RepoId}}/settings"
 )
 
 const (
 	HeaderFilenamePattern = `filename=\"(?P<filename>.*?)\";`
 	CommitHashPattern     = "^[0-9a-f]{40}$"
+	Sha256Pattern         = "^[0-9a-f]{64}$"
 )
 
 var IsStaging bool
+var IsOffline bool
+var DisableProgressBars bool
 var HFEndpoint = os.Getenv("HF_ENDPOINT")
 
 const DownloadChunkSize = 1024 * 1024
 const DefaultRetries = 5
+const DefaultMaxWorkers = 8
+const DefaultParallelChunkSize = 10 * 1024 * 1024
 
 var RepoTypes = []string{ModelRepoType, SpaceRepoType, DatasetRepoType}
 var RepoTypesUrlPrefixes = map[string]string{
@@ -74,6 +105,14 @@ var RepoTypesUrlPrefixes = map[string]string{
 }
 
 var symlinkSupported map[string]bool
+var symlinkSupportedLock sync.Mutex
+
+// cachePruneLock serializes the pruning of the caches by the downloads of this process
+var cachePruneLock sync.Mutex
+
+// defaultHTTPClient is shared by every Client that doesn't bring its own, so that connections are pooled
+// across requests. The idle pool per host is raised to fit the concurrent downloads of a snapshot.
+var defaultHTTPClient = newDefaultHTTPClient()
 
 type DownloadParams struct {
 	Repo           *Repo
@@ -82,6 +121,20 @@ type DownloadParams struct {
 	Revision       string
 	ForceDownload  bool
 	LocalFilesOnly bool
+	// AllowPatterns and IgnorePatterns filter the files of a snapshot download, using shell-style
+	// patterns (e.g. `*.safetensors` or `vae/`). When AllowPatterns is empty, every file is allowed.
+	AllowPatterns  []string
+	IgnorePatterns []string
+	// MaxWorkers overrides Client.MaxWorkers for this download.
+	MaxWorkers int
+	// FailFast stops a snapshot download on the first failed file, instead of downloading the remaining ones.
+	FailFast bool
+	// LocalDir, when set, downloads the files as plain files in this folder instead of the cache, like the
+	// `local_dir` of the python package. Download metadata is kept in its `.cache/huggingface` folder, so that
+	// files already up to date are not downloaded again.
+	LocalDir string
+	// RateLimiter overrides Client.RateLimiter for this download. It is shared by all the files of a snapshot.
+	RateLimiter *RateLimiter
 }
 
 func init() {
@@ -91,6 +144,19 @@ func init() {
 	}
 
 	IsStaging = isStaging
+
+	isOffline, err := strconv.ParseBool(os.Getenv("HF_HUB_OFFLINE"))
+	if err != nil {
+		isOffline = false
+	}
+	IsOffline = isOffline
+
+	disableProgressBars, err := strconv.ParseBool(os.Getenv("HF_HUB_DISABLE_PROGRESS_BARS"))
+	if err != nil {
+		disableProgressBars = false
+	}
+	DisableProgressBars = disableProgressBars
+
 	if HFEndpoint == "" {
 		if isStaging {
 			HFEndpoint = defaultHfStagingEndpoint
@@ -100,6 +166,14 @@ func init() {
 	}
 }
 
+func newDefaultHTTPClient() *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.MaxIdleConns = 100
+	transport.MaxIdleConnsPerHost = 32
+
+	return &http.Client{Transport: transport}
+}
+
 func NewClient(endpoint string, token string, cacheDir string) *Client {
 	cacheDir, err := expandPath(cacheDir)
 	if err != nil {
@@ -139,8 +213,15 @@ func DefaultClient() *Client {
 		panic(err)
 	}
 
+	// Like the python package, the token is not sent implicitly when HF_HUB_DISABLE_IMPLICIT_TOKEN is set
+	token := ""
+	if disableImplicitToken, _ := strconv.ParseBool(os.Getenv("HF_HUB_DISABLE_IMPLICIT_TOKEN")); !disableImplicitToken {
+		token = GetToken()
+	}
+
 	return &Client{
 		Endpoint:  HFEndpoint,
+		Token:     token,
 		CacheDir:  cacheDir,
 		UserAgent: DefaultUserAgent,
 	}
@@ -184,7 +265,56 @@ func (client *Client) WithUserAgent(userAgent string) *Client {
 	return client
 }
 
+func (client *Client) WithMaxWorkers(maxWorkers int) *Client {
+	client.MaxWorkers = maxWorkers
+	return client
+}
+
+func (client *Client) WithParallelConnections(parallelConnections int) *Client {
+	client.ParallelConnections = parallelConnections
+	return client
+}
+
+func (client *Client) WithParallelChunkSize(parallelChunkSize int64) *Client {
+	client.ParallelChunkSize = parallelChunkSize
+	return client
+}
+
+func (client *Client) WithRetryPolicy(retryPolicy *RetryPolicy) *Client {
+	client.RetryPolicy = retryPolicy
+	return client
+}
+
+// WithRateLimiter limits the bandwidth of the downloads, e.g. NewRateLimiter(10 * 1024 * 1024) for 10 MB/s.
+func (client *Client) WithRateLimiter(rateLimiter *RateLimiter) *Client {
+	client.RateLimiter = rateLimiter
+	return client
+}
+
+func (client *Client) WithMaxCacheSize(maxCacheSize int64) *Client {
+	client.MaxCacheSize = maxCacheSize
+	return client
+}
+
+// WithProgressReporter sets where the download progress is reported, e.g. NoopProgressReporter{} to silence it.
+func (client *Client) WithProgressReporter(reporter ProgressReporter) *Client {
+	client.ProgressReporter = reporter
+	return client
+}
+
+// WithHTTPClient sets the http.Client used for every request, e.g. to configure proxies, custom CAs or mTLS.
+func (client *Client) WithHTTPClient(httpClient *http.Client) *Client {
+	client.HTTPClient = httpClient
+	return client
+}
+
 func (client *Client) Download(params *DownloadParams) (string, error) {
+	return client.DownloadContext(context.Background(), params)
+}
+
+// DownloadContext is like Download, but aborts every in-flight request once ctx is done.
+// Partially downloaded files are kept as `.incomplete` blobs so that the next call can resume them.
+func (client *Client) DownloadContext(ctx context.Context, params *DownloadParams) (string, error) {
 	if params.Repo.Type == "" {
 		params.Repo.Type = ModelRepoType
 	}
@@ -201,12 +331,13 @@ func (client *Client) Download(params *DownloadParams) (string, error) {
 		client.CacheDir = DefaultCacheDir
 	}
 
+	if !isValidRepoType(params.Repo.Type) {
+		return "", fmt.Errorf("invalid repo type: %s", params.Repo.Type)
+	}
+
 	if params.FileName == "" {
-		if params.Repo.Type != ModelRepoType {
-			return "", fmt.Errorf("invalid repo type: %s", params.Repo.Type)
-		}
-		return snapshotDownload(client, params)
+		return snapshotDownload(ctx, client, params)
 	} else {
-		return fileDownload(client, params)
+		return fileDownload(ctx, client, params, true)
 	}
 }
@@ -0,0 +1,72 @@
+package hub
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testCommitHash = "0123456789abcdef0123456789abcdef01234567"
+
+// newTestServer serves the files of every repo as the Hub does, as LFS files at testCommitHash. The downloads
+// support ranges, and the model info lists the files.
+func newTestServer(t *testing.T, files map[string]string) *httptest.Server {
+	t.Helper()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/api/models/") {
+			siblings := []RepoSibling{}
+			for fileName := range files {
+				siblings = append(siblings, RepoSibling{RFileName: fileName})
+			}
+			json.NewEncoder(w).Encode(ModelInfo{Sha: testCommitHash, Siblings: siblings})
+			return
+		}
+
+		_, path, found := strings.Cut(r.URL.Path, "/resolve/")
+		if !found {
+			http.NotFound(w, r)
+			return
+		}
+		_, fileName, _ := strings.Cut(path, "/")
+
+		w.Header().Set("X-Repo-Commit", testCommitHash)
+		content, ok := files[fileName]
+		if !ok {
+			w.Header().Set("X-Error-Code", "EntryNotFound")
+			http.NotFound(w, r)
+			return
+		}
+
+		serveTestFile(w, r, content, sha256Hex(content))
+	}))
+	t.Cleanup(server.Close)
+
+	return server
+}
+
+// serveTestFile serves content with the given ETag, with the ranges support of http.ServeContent.
+func serveTestFile(w http.ResponseWriter, r *http.Request, content string, etag string) {
+	w.Header().Set("ETag", `"`+etag+`"`)
+	http.ServeContent(w, r, "", time.Time{}, strings.NewReader(content))
+}
+
+func sha256Hex(content string) string {
+	sum := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(sum[:])
+}
+
+// newTestClient returns a client of the test server, with a new cache folder.
+func newTestClient(t *testing.T, server *httptest.Server, reporter ProgressReporter) *Client {
+	t.Helper()
+
+	if reporter == nil {
+		reporter = NoopProgressReporter{}
+	}
+	return NewClient(server.URL, "", t.TempDir()).WithProgressReporter(reporter)
+}
@@ -0,0 +1,147 @@
+package hub
+
+import (
+	"context"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// RepoTreeEntry is a file or folder of a repo, as listed by ListRepoTree.
+type RepoTreeEntry struct {
+	// Type is "file" or "directory".
+	Type string `json:"type"`
+	Path string `json:"path"`
+	// Oid is the git object id of the file or folder.
+	Oid  string `json:"oid"`
+	Size int64  `json:"size"`
+	// Lfs is only set for files stored with LFS.
+	Lfs *RepoTreeLfsInfo `json:"lfs"`
+	// LastCommit is the last commit that modified the entry, only set when the tree is expanded.
+	LastCommit *RepoTreeLastCommit `json:"lastCommit"`
+}
+
+// RepoTreeLfsInfo describes a file stored with LFS. Oid is the sha256 of its content.
+type RepoTreeLfsInfo struct {
+	Oid         string `json:"oid"`
+	Size        int64  `json:"size"`
+	PointerSize int64  `json:"pointerSize"`
+}
+
+type RepoTreeLastCommit struct {
+	Oid   string    `json:"id"`
+	Title string    `json:"title"`
+	Date  time.Time `json:"date"`
+}
+
+// IsFile reports whether the entry is a file rather than a folder.
+func (entry *RepoTreeEntry) IsFile() bool {
+	return entry.Type == "file"
+}
+
+// ModelFilter filters and sorts the models listed by ListModels. Empty fields are ignored.
+type ModelFilter struct {
+	// Search matches the models whose id contains it.
+	Search string
+	Author string
+	// Tags only keeps the models with all of these tags, e.g. "text-classification" or "license:mit".
+	Tags        []string
+	Library     string
+	PipelineTag string
+	// Sort is the property to sort the models by, e.g. "downloads", "likes" or "lastModified".
+	Sort string
+	// Descending sorts the models in descending order of Sort.
+	Descending bool
+	// Limit is the maximum number of models to list, or 0 for all of them.
+	Limit int
+	// Expand lists the properties to return for each model, e.g. "downloads" or "siblings".
+	Expand []string
+}
+
+// ListModels lists the models of the Hub matching the filter. Port of `HfApi.list_models` from the python package.
+//
+// example:
+//
+//	it := client.ListModels(ctx, &hub.ModelFilter{Author: "google", Sort: "downloads", Descending: true, Limit: 10})
+//	for it.Next() {
+//		fmt.Println(it.Value().Id)
+//	}
+func (client *Client) ListModels(ctx context.Context, filter *ModelFilter) *Iterator[*ModelInfo] {
+	if filter == nil {
+		filter = &ModelFilter{}
+	}
+
+	listUrl, err := formatUrl(hfListModelsTemplate, map[string]string{"Endpoint": client.Endpoint})
+	if err != nil {
+		return &Iterator[*ModelInfo]{err: err}
+	}
+
+	query := url.Values{}
+	if filter.Search != "" {
+		query.Set("search", filter.Search)
+	}
+	if filter.Author != "" {
+		query.Set("author", filter.Author)
+	}
+	for _, tag := range filter.Tags {
+		query.Add("filter", tag)
+	}
+	// Like the python package, libraries are filtered as tags
+	if filter.Library != "" {
+		query.Add("filter", filter.Library)
+	}
+	if filter.PipelineTag != "" {
+		query.Set("pipeline_tag", filter.PipelineTag)
+	}
+	if filter.Sort != "" {
+		query.Set("sort", filter.Sort)
+	}
+	if filter.Descending {
+		query.Set("direction", "-1")
+	}
+	if filter.Limit > 0 {
+		query.Set("limit", strconv.Itoa(filter.Limit))
+	}
+	for _, property := range filter.Expand {
+		query.Add("expand", property)
+	}
+
+	if len(query) > 0 {
+		listUrl += "?" + query.Encode()
+	}
+
+	return newIterator[*ModelInfo](ctx, client, listUrl, filter.Limit)
+}
+
+// ListRepoTree lists the files and folders under pathInRepo (the root of the repo when empty) at repo.Revision.
+// Folders are listed recursively when recursive is set. When expand is set, the last commit of each entry is
+// returned too, which is slower. Port of `HfApi.list_repo_tree` from the python package.
+func (client *Client) ListRepoTree(ctx context.Context, repo *Repo, pathInRepo string, recursive bool, expand bool) *Iterator[*RepoTreeEntry] {
+	if _, err := validateRepoType(repo); err != nil {
+		return &Iterator[*RepoTreeEntry]{err: err}
+	}
+
+	params := client.repoUrlParams(repo, "")
+	params["Path"] = ""
+	if pathInRepo = cleanPathInRepo(pathInRepo); pathInRepo != "" {
+		params["Path"] = "/" + escapePathInRepo(pathInRepo)
+	}
+	treeUrl, err := formatUrl(hfRepoTreeTemplate, params)
+	if err != nil {
+		return &Iterator[*RepoTreeEntry]{err: err}
+	}
+
+	query := url.Values{}
+	if recursive {
+		query.Set("recursive", "true")
+	}
+	if expand {
+		query.Set("expand", "true")
+	}
+
+	if len(query) > 0 {
+		treeUrl += "?" + query.Encode()
+	}
+
+	return newIterator[*RepoTreeEntry](ctx, client, treeUrl, 0)
+}
@@ -0,0 +1,265 @@
+package hub
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// localDownloadPaths are the paths used to download a file to a local directory: the file itself, and the lock
+// and metadata files kept in the `.cache/huggingface/download` folder of the directory.
+type localDownloadPaths struct {
+	filePath     string
+	lockPath     string
+	metadataPath string
+}
+
+// localDownloadMetadata is the content of a metadata file: the commit hash and ETag of the downloaded file,
+// and the time (in seconds since the epoch) it was checked against the Hub.
+type localDownloadMetadata struct {
+	commitHash string
+	etag       string
+	timestamp  float64
+}
+
+// incompletePath returns the path the file is downloaded to before being moved in place.
+// The name of the file is hashed to keep the path short.
+func (paths *localDownloadPaths) incompletePath(etag string) string {
+	hash := sha1.Sum([]byte(filepath.Base(paths.metadataPath)))
+	name := fmt.Sprintf("%s.%s.incomplete", base64.URLEncoding.EncodeToString(hash[:]), etag)
+	return filepath.Join(filepath.Dir(paths.metadataPath), name)
+}
+
+// getLocalDownloadPaths returns the paths to download fileName to localDir, and creates their parent folders.
+// Port of `get_local_download_paths` from the python package.
+func getLocalDownloadPaths(localDir string, fileName string) (*localDownloadPaths, error) {
+	fileName = filepath.FromSlash(fileName)
+	if !filepath.IsLocal(fileName) {
+		return nil, fmt.Errorf("invalid file name: %s, it must be a relative path inside the repo", fileName)
+	}
+
+	huggingfaceDir := filepath.Join(localDir, ".cache", "huggingface")
+	downloadDir := filepath.Join(huggingfaceDir, "download")
+	paths := &localDownloadPaths{
+		filePath:     filepath.Join(localDir, fileName),
+		lockPath:     filepath.Join(downloadDir, fileName+".lock"),
+		metadataPath: filepath.Join(downloadDir, fileName+".metadata"),
+	}
+
+	if err := os.MkdirAll(filepath.Dir(paths.filePath), os.ModePerm); err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(paths.metadataPath), os.ModePerm); err != nil {
+		return nil, err
+	}
+
+	// Keep the metadata out of git when the directory is a git repo
+	gitignorePath := filepath.Join(huggingfaceDir, ".gitignore")
+	if _, err := os.Stat(gitignorePath); errors.Is(err, os.ErrNotExist) {
+		if err := os.WriteFile(gitignorePath, []byte("*"), 0644); err != nil {
+			return nil, err
+		}
+	}
+
+	return paths, nil
+}
+
+// readDownloadMetadata returns the metadata of a file downloaded to a local directory, or nil if there is none or
+// the file has been modified since it was downloaded. A corrupted metadata file is removed.
+func readDownloadMetadata(paths *localDownloadPaths) *localDownloadMetadata {
+	file, err := os.Open(paths.metadataPath)
+	if err != nil {
+		return nil
+	}
+	defer file.Close()
+
+	var lines []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() && len(lines) < 3 {
+		lines = append(lines, strings.TrimSpace(scanner.Text()))
+	}
+
+	var timestamp float64
+	if len(lines) == 3 {
+		timestamp, err = strconv.ParseFloat(lines[2], 64)
+	}
+	if len(lines) != 3 || err != nil {
+		log.Printf("invalid metadata file %s, removing it\n", paths.metadataPath)
+		file.Close()
+		os.Remove(paths.metadataPath)
+		return nil
+	}
+
+	fileInfo, err := os.Stat(paths.filePath)
+	if err != nil {
+		return nil
+	}
+
+	// Allow a 1s difference, since the modification time may not be precise
+	if float64(fileInfo.ModTime().UnixNano())/1e9-1 > timestamp {
+		return nil
+	}
+
+	return &localDownloadMetadata{
+		commitHash: lines[0],
+		etag:       lines[1],
+		timestamp:  timestamp,
+	}
+}
+
+func writeDownloadMetadata(paths *localDownloadPaths, commitHash string, etag string) error {
+	timestamp := strconv.FormatFloat(float64(time.Now().UnixNano())/1e9, 'f', -1, 64)
+	content := fmt.Sprintf("%s\n%s\n%s\n", commitHash, etag, timestamp)
+	return os.WriteFile(paths.metadataPath, []byte(content), 0644)
+}
+
+// fileDownloadToLocalDir downloads a file as a plain file in params.LocalDir, instead of the cache.
+// Port of `_hf_hub_download_to_local_dir` from the python package.
+func fileDownloadToLocalDir(ctx context.Context, client *Client, params *DownloadParams, fileName string) (path string, err error) {
+	// downloadToTmpAndMove reports the progress of the file, which is otherwise already up to date
+	progressReported := false
+	defer func() {
+		if err == nil && !progressReported {
+			reportCachedFile(client, params.Repo.Id, fileName, path)
+		}
+	}()
+
+	localDir, err := expandPath(params.LocalDir)
+	if err != nil {
+		return "", err
+	}
+
+	paths, err := getLocalDownloadPaths(localDir, fileName)
+	if err != nil {
+		return "", err
+	}
+
+	lock, err := lockFile(ctx, paths.lockPath)
+	if err != nil {
+		return "", err
+	}
+	defer lock.Unlock()
+
+	revision := params.Revision
+	forceDownload := params.ForceDownload
+
+	_, err = os.Stat(paths.filePath)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return "", err
+	}
+	fileExists := err == nil
+
+	// The file was downloaded at this commit, no need to check it against the Hub
+	if !forceDownload && fileExists && regexp.MustCompile(CommitHashPattern).MatchString(revision) {
+		if metadata := readDownloadMetadata(paths); metadata != nil && metadata.commitHash == revision {
+			return paths.filePath, nil
+		}
+	}
+
+	if params.LocalFilesOnly || IsOffline {
+		if fileExists && !forceDownload {
+			return paths.filePath, nil
+		}
+
+		return "", &LocalEntryNotFoundError{
+			Message: "cannot find the requested file in the local directory and outgoing traffic has been disabled. To enable look-ups and downloads online, set LocalFilesOnly to false and unset HF_HUB_OFFLINE",
+		}
+	}
+
+	headers := client.buildHeaders()
+	fileUrl := client.FileURL(params.Repo, fileName, revision)
+	fileMetadata, err := client.getFileMetadata(ctx, fileUrl, headers)
+	if err != nil {
+		if isOfflineError(err) {
+			if fileExists && !forceDownload {
+				log.Printf("couldn't reach the Hub to check '%s', using the local file: %s\n", fileName, err)
+				return paths.filePath, nil
+			}
+
+			return "", &LocalEntryNotFoundError{
+				Message: "an error happened while trying to locate the file on the Hub and we cannot find the requested file in the local directory. Please check your internet connection and try again",
+				Err:     err,
+			}
+		}
+
+		return "", err
+	}
+
+	if fileMetadata.CommitHash == "" {
+		return "", fmt.Errorf("no commit hash found for this file. It is likely that the file is not yet available on HF Hub")
+	}
+
+	if fileMetadata.ETag == "" {
+		return "", fmt.Errorf("no ETag found for this file. It is likely that the file is not yet available on HF Hub")
+	}
+
+	if !forceDownload && fileExists {
+		metadata := readDownloadMetadata(paths)
+		if metadata != nil && metadata.etag == fileMetadata.ETag {
+			return paths.filePath, writeDownloadMetadata(paths, fileMetadata.CommitHash, fileMetadata.ETag)
+		}
+
+		// Without metadata, LFS files can still be checked against their sha256, which is their ETag
+		if metadata == nil && regexp.MustCompile(Sha256Pattern).MatchString(fileMetadata.ETag) {
+			hash, err := fileSha256(paths.filePath)
+			if err != nil {
+				return "", err
+			}
+
+			if hash == fileMetadata.ETag {
+				return paths.filePath, writeDownloadMetadata(paths, fileMetadata.CommitHash, fileMetadata.ETag)
+			}
+		}
+	}
+
+	// The file may already be in the cache, in which case it is copied
+	if !forceDownload {
+		storageFolder := filepath.Join(client.CacheDir, repoFolderName(params.Repo.Id, params.Repo.Type))
+		if cachedPath, err := cachedPointerPath(storageFolder, fileMetadata.CommitHash, fileName); err == nil {
+			if err := copyFile(cachedPath, paths.filePath); err != nil {
+				return "", err
+			}
+			return paths.filePath, writeDownloadMetadata(paths, fileMetadata.CommitHash, fileMetadata.ETag)
+		}
+	}
+
+	// Remove the outdated file first
+	if err := os.Remove(paths.filePath); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return "", err
+	}
+
+	progressReported = true
+	err = downloadToTmpAndMove(ctx, client, paths.incompletePath(fileMetadata.ETag), paths.filePath, fileUrl, headers, fileMetadata.Size, fileMetadata.ETag, params.Repo.Id, fileName, forceDownload, client.rateLimiter(params))
+	if err != nil {
+		return "", err
+	}
+
+	return paths.filePath, writeDownloadMetadata(paths, fileMetadata.CommitHash, fileMetadata.ETag)
+}
+
+func fileSha256(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
@@ -0,0 +1,287 @@
+package hub
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+)
+
+// errRangeNotSupported is returned by downloadFileParallel when the server ignores range requests.
+var errRangeNotSupported = errors.New("the server doesn't support range requests")
+
+// rangesState is saved in a sidecar file next to the `.incomplete` file of a parallel download.
+// Written holds the number of bytes written from the start of each chunk, so that every chunk can be resumed.
+type rangesState struct {
+	Size      int64   `json:"size"`
+	ChunkSize int64   `json:"chunkSize"`
+	Written   []int64 `json:"written"`
+}
+
+// parallelDownload is a file being downloaded in chunks over several connections, into a preallocated file.
+type parallelDownload struct {
+	client   *Client
+	url      string
+	headers  *http.Header
+	file     *os.File
+	repoId   string
+	filename string
+	limiter  *RateLimiter
+
+	// stateLock guards state, which is written by every connection
+	stateLock sync.Mutex
+	state     *rangesState
+	statePath string
+	progress  ProgressReporter
+}
+
+func rangesPath(incompletePath string) string {
+	return incompletePath + ".ranges"
+}
+
+func (client *Client) parallelChunkSize() int64 {
+	if client.ParallelChunkSize > 0 {
+		return client.ParallelChunkSize
+	}
+	return DefaultParallelChunkSize
+}
+
+// canDownloadInParallel reports whether a file of the given size is downloaded over several connections.
+func (client *Client) canDownloadInParallel(incompletePath string, size int64) bool {
+	if client.ParallelConnections <= 1 || size <= client.parallelChunkSize() {
+		return false
+	}
+
+	// An incomplete file without ranges comes from a single connection download, which is resumed as such
+	if info, err := os.Stat(incompletePath); err == nil && info.Size() > 0 {
+		if _, err := os.Stat(rangesPath(incompletePath)); err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// downloadFileParallel downloads the file at url to incompletePath in chunks of Client.ParallelChunkSize bytes,
+// over Client.ParallelConnections connections. The chunks already written by a previous download are resumed.
+func downloadFileParallel(ctx context.Context, client *Client, url string, incompletePath string, headers *http.Header, size int64, repoId string, filename string, limiter *RateLimiter) error {
+	chunkSize := client.parallelChunkSize()
+	nbChunks := int((size + chunkSize - 1) / chunkSize)
+
+	download := &parallelDownload{
+		client:    client,
+		url:       url,
+		headers:   headers,
+		repoId:    repoId,
+		filename:  filename,
+		limiter:   limiter,
+		statePath: rangesPath(incompletePath),
+		progress:  client.progressReporter(),
+	}
+
+	download.state = loadRangesState(download.statePath)
+	if download.state == nil || download.state.Size != size || download.state.ChunkSize != chunkSize || len(download.state.Written) != nbChunks {
+		// The content of the incomplete file can't be trusted without a matching state
+		download.state = &rangesState{Size: size, ChunkSize: chunkSize, Written: make([]int64, nbChunks)}
+		if err := os.Remove(incompletePath); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+
+	file, err := os.OpenFile(incompletePath, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	download.file = file
+
+	// Preallocate the file, so that every chunk can be written at its offset
+	if err := file.Truncate(size); err != nil {
+		return err
+	}
+
+	if err := download.saveState(); err != nil {
+		return err
+	}
+
+	var resumedBytes int64
+	for _, written := range download.state.Written {
+		resumedBytes += written
+	}
+	download.progress.FileStarted(repoId, filename, size, resumedBytes)
+
+	// downloadCtx is cancelled on the first failed chunk
+	downloadCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		wg       sync.WaitGroup
+		errOnce  sync.Once
+		firstErr error
+	)
+
+	chunks := make(chan int)
+	for i := 0; i < min(client.ParallelConnections, nbChunks); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for chunk := range chunks {
+				err := download.downloadChunk(downloadCtx, chunk)
+				if err == nil {
+					err = download.saveState()
+				}
+
+				if err != nil {
+					errOnce.Do(func() {
+						firstErr = err
+						cancel()
+					})
+					return
+				}
+			}
+		}()
+	}
+
+sendLoop:
+	for chunk := 0; chunk < nbChunks; chunk++ {
+		select {
+		case chunks <- chunk:
+		case <-downloadCtx.Done():
+			break sendLoop
+		}
+	}
+	close(chunks)
+	wg.Wait()
+
+	// The progress is saved whatever happened, so that the next download resumes from it
+	saveErr := download.saveState()
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if firstErr != nil {
+		return firstErr
+	}
+	if saveErr != nil {
+		return saveErr
+	}
+
+	if err := file.Close(); err != nil {
+		return err
+	}
+	return os.Remove(download.statePath)
+}
+
+// downloadChunk downloads the rest of a chunk, retrying following the client's RetryPolicy when the connection is
+// lost in the middle of it.
+func (d *parallelDownload) downloadChunk(ctx context.Context, chunk int) error {
+	policy := d.client.retryPolicy()
+	for failures := 0; ; failures++ {
+		written, retryable, err := d.downloadChunkOnce(ctx, chunk)
+		if err == nil || !retryable {
+			return err
+		}
+
+		if written > 0 {
+			failures = 0
+		}
+		if err := policy.retry(ctx, failures, err, fmt.Sprintf("download of chunk %d of %s", chunk, d.filename)); err != nil {
+			return err
+		}
+	}
+}
+
+// downloadChunkOnce downloads the rest of a chunk with a range request, and writes it at its offset in the file.
+// Only the errors happening while reading the body are retryable, since requestWrapper already retried the request.
+func (d *parallelDownload) downloadChunkOnce(ctx context.Context, chunk int) (written int64, retryable bool, err error) {
+	start := int64(chunk) * d.state.ChunkSize
+	end := min(start+d.state.ChunkSize, d.state.Size)
+
+	d.stateLock.Lock()
+	offset := start + d.state.Written[chunk]
+	d.stateLock.Unlock()
+
+	if offset >= end {
+		return 0, false, nil
+	}
+
+	headers := d.headers.Clone()
+	headers.Set("Range", fmt.Sprintf("bytes=%d-%d", offset, end-1))
+
+	response, err := d.client.requestWrapper(ctx, "GET", d.url, true, true, &headers, nil)
+	if err != nil {
+		return 0, false, err
+	}
+	defer response.Body.Close()
+
+	if err := hfRaiseForStatus(response); err != nil {
+		return 0, false, err
+	}
+
+	if response.StatusCode != http.StatusPartialContent {
+		return 0, false, errRangeNotSupported
+	}
+
+	buf := make([]byte, min(DownloadChunkSize, end-offset))
+	for offset < end {
+		n, err := response.Body.Read(buf[:min(int64(len(buf)), end-offset)])
+		if n > 0 {
+			if waitErr := d.limiter.WaitN(ctx, n); waitErr != nil {
+				return written, false, waitErr
+			}
+
+			if _, writeErr := d.file.WriteAt(buf[:n], offset); writeErr != nil {
+				return written, false, fmt.Errorf("error writing to file: %v", writeErr)
+			}
+
+			offset += int64(n)
+			written += int64(n)
+			d.stateLock.Lock()
+			d.state.Written[chunk] += int64(n)
+			d.stateLock.Unlock()
+			d.progress.BytesWritten(d.repoId, d.filename, int64(n))
+		}
+
+		// the last bytes may come along with io.EOF, so it's only checked once they are written
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return written, true, err
+		}
+	}
+
+	if offset < end {
+		return written, true, fmt.Errorf("error while downloading bytes %d-%d of %s: %w", start, end-1, d.filename, io.ErrUnexpectedEOF)
+	}
+	return written, false, nil
+}
+
+func (d *parallelDownload) saveState() error {
+	// the lock is held while writing, so that the connections don't write the file concurrently
+	d.stateLock.Lock()
+	defer d.stateLock.Unlock()
+
+	data, err := json.Marshal(d.state)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(d.statePath, data, 0644)
+}
+
+// loadRangesState returns the state saved by a previous parallel download, or nil if there is none.
+func loadRangesState(path string) *rangesState {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+
+	state := &rangesState{}
+	if err := json.Unmarshal(data, state); err != nil {
+		return nil
+	}
+	return state
+}
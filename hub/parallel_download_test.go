@@ -0,0 +1,141 @@
+package hub
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+// countingResponseWriter counts the bytes of the response bodies sent by a test server.
+type countingResponseWriter struct {
+	http.ResponseWriter
+	written *atomic.Int64
+}
+
+func (w countingResponseWriter) Write(p []byte) (int, error) {
+	n, err := w.ResponseWriter.Write(p)
+	w.written.Add(int64(n))
+	return n, err
+}
+
+func newParallelTestClient(t *testing.T, server *httptest.Server) *Client {
+	return newTestClient(t, server, nil).WithParallelConnections(4).WithParallelChunkSize(10)
+}
+
+func TestParallelDownload(t *testing.T) {
+	content := strings.Repeat("0123456789abcdefghij", 5)[:95]
+
+	var (
+		ranges     []string
+		rangesLock sync.Mutex
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rangesLock.Lock()
+		ranges = append(ranges, r.Header.Get("Range"))
+		rangesLock.Unlock()
+		serveTestFile(w, r, content, sha256Hex(content))
+	}))
+	defer server.Close()
+
+	path, err := downloadTestFile(t, newParallelTestClient(t, server), server.URL, len(content), sha256Hex(content))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assertFileContent(t, path, content)
+	assertExists(t, rangesPath(path+".incomplete"), false)
+	if len(ranges) != 10 {
+		t.Errorf("the file was downloaded with %d requests, want one per chunk: %v", len(ranges), ranges)
+	}
+}
+
+func TestParallelDownloadResumesRanges(t *testing.T) {
+	content := strings.Repeat("0123456789abcdefghij", 5)[:95]
+
+	var served atomic.Int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		serveTestFile(countingResponseWriter{w, &served}, r, content, sha256Hex(content))
+	}))
+	defer server.Close()
+
+	// A previous download wrote the first chunk and half of the second one
+	destinationPath := filepath.Join(t.TempDir(), "file")
+	incompletePath := destinationPath + ".incomplete"
+	incomplete := make([]byte, len(content))
+	copy(incomplete, content[:15])
+	if err := os.WriteFile(incompletePath, incomplete, 0644); err != nil {
+		t.Fatal(err)
+	}
+	state, _ := json.Marshal(rangesState{Size: 95, ChunkSize: 10, Written: []int64{10, 5, 0, 0, 0, 0, 0, 0, 0, 0}})
+	if err := os.WriteFile(rangesPath(incompletePath), state, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	client := newParallelTestClient(t, server)
+	if err := downloadToTmpAndMove(context.Background(), client, incompletePath, destinationPath, server.URL, &http.Header{}, len(content), sha256Hex(content), "org/repo", "file", false, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	assertFileContent(t, destinationPath, content)
+	assertExists(t, rangesPath(incompletePath), false)
+	if served.Load() != 80 {
+		t.Errorf("%d bytes were downloaded, want the 80 missing bytes", served.Load())
+	}
+}
+
+func TestParallelDownloadFallsBackToSingleConnection(t *testing.T) {
+	content := strings.Repeat("0123456789abcdefghij", 5)[:95]
+
+	var requests atomic.Int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		r.Header.Del("Range")
+		serveTestFile(w, r, content, sha256Hex(content))
+	}))
+	defer server.Close()
+
+	path, err := downloadTestFile(t, newParallelTestClient(t, server), server.URL, len(content), sha256Hex(content))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assertFileContent(t, path, content)
+	assertExists(t, rangesPath(path+".incomplete"), false)
+	if requests.Load() > 5 {
+		t.Errorf("%d requests were sent, want the parallel download to stop at the first full response", requests.Load())
+	}
+}
+
+func TestSingleConnectionDownloadRestartsParallelLeftovers(t *testing.T) {
+	content := strings.Repeat("0123456789abcdefghij", 5)[:95]
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		serveTestFile(w, r, content, sha256Hex(content))
+	}))
+	defer server.Close()
+
+	// A parallel download preallocated the whole file, which must not be resumed from its end
+	destinationPath := filepath.Join(t.TempDir(), "file")
+	incompletePath := destinationPath + ".incomplete"
+	if err := os.WriteFile(incompletePath, make([]byte, 50), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(rangesPath(incompletePath), []byte(`{"size":95,"chunkSize":10,"written":[10]}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	client := newTestClient(t, server, nil)
+	if err := downloadToTmpAndMove(context.Background(), client, incompletePath, destinationPath, server.URL, &http.Header{}, len(content), sha256Hex(content), "org/repo", "file", false, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	assertFileContent(t, destinationPath, content)
+	assertExists(t, rangesPath(incompletePath), false)
+}
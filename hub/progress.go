@@ -0,0 +1,208 @@
+package hub
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/schollz/progressbar/v3"
+)
+
+// ProgressReporter receives the progress of the downloads made by a Client.
+// The files of a snapshot are downloaded concurrently, so implementations must be safe for concurrent use.
+type ProgressReporter interface {
+	// SnapshotStarted is called before the files of a snapshot are downloaded.
+	// totalBytes is the size of every file of the snapshot, or 0 when the Hub didn't report it.
+	SnapshotStarted(repoId string, totalFiles int, totalBytes int64)
+	// SnapshotFinished is called once every file of a snapshot has been processed.
+	SnapshotFinished(repoId string, downloadedFiles int, failedFiles int)
+	// FileStarted is called when the content of a file starts streaming to disk.
+	// resumedBytes is the size of the partial download being resumed, already included in totalBytes.
+	FileStarted(repoId string, fileName string, totalBytes int64, resumedBytes int64)
+	// BytesWritten is called every time a chunk of a file is written to disk.
+	BytesWritten(repoId string, fileName string, n int64)
+	FileFinished(repoId string, fileName string)
+	FileFailed(repoId string, fileName string, err error)
+	// FileCached is called instead of the other file events when a file is already up to date, with its size,
+	// so that the bytes of a snapshot add up to its totalBytes.
+	FileCached(repoId string, fileName string, size int64)
+}
+
+type ProgressEventType int
+
+const (
+	SnapshotStartedEvent ProgressEventType = iota
+	SnapshotFinishedEvent
+	FileStartedEvent
+	BytesWrittenEvent
+	FileFinishedEvent
+	FileFailedEvent
+	FileCachedEvent
+)
+
+// ProgressEvent is a ProgressReporter call, as sent by a ChannelProgressReporter.
+// Only the fields related to the event type are set.
+type ProgressEvent struct {
+	Type     ProgressEventType
+	RepoId   string
+	FileName string
+	// TotalFiles, DownloadedFiles and FailedFiles are set for snapshot events.
+	TotalFiles      int
+	DownloadedFiles int
+	FailedFiles     int
+	// TotalBytes is set for SnapshotStartedEvent and FileStartedEvent.
+	TotalBytes int64
+	// Bytes is the number of resumed bytes for FileStartedEvent, of written bytes for BytesWrittenEvent, and the
+	// size of the file for FileCachedEvent.
+	Bytes int64
+	Err   error
+}
+
+// ChannelProgressReporter sends every progress event to its Events channel.
+// Sends are blocking by default, so the channel must be drained for downloads to make progress.
+type ChannelProgressReporter struct {
+	Events chan ProgressEvent
+	// DropWhenFull drops the events that don't fit in the channel instead of blocking the downloads, e.g. for a
+	// UI that may stop reading the events before the downloads are done.
+	DropWhenFull bool
+}
+
+func NewChannelProgressReporter(bufferSize int) *ChannelProgressReporter {
+	return &ChannelProgressReporter{
+		Events: make(chan ProgressEvent, bufferSize),
+	}
+}
+
+func (r *ChannelProgressReporter) WithDropWhenFull(dropWhenFull bool) *ChannelProgressReporter {
+	r.DropWhenFull = dropWhenFull
+	return r
+}
+
+func (r *ChannelProgressReporter) send(event ProgressEvent) {
+	if !r.DropWhenFull {
+		r.Events <- event
+		return
+	}
+
+	select {
+	case r.Events <- event:
+	default:
+	}
+}
+
+func (r *ChannelProgressReporter) SnapshotStarted(repoId string, totalFiles int, totalBytes int64) {
+	r.send(ProgressEvent{Type: SnapshotStartedEvent, RepoId: repoId, TotalFiles: totalFiles, TotalBytes: totalBytes})
+}
+
+func (r *ChannelProgressReporter) SnapshotFinished(repoId string, downloadedFiles int, failedFiles int) {
+	r.send(ProgressEvent{Type: SnapshotFinishedEvent, RepoId: repoId, DownloadedFiles: downloadedFiles, FailedFiles: failedFiles})
+}
+
+func (r *ChannelProgressReporter) FileStarted(repoId string, fileName string, totalBytes int64, resumedBytes int64) {
+	r.send(ProgressEvent{Type: FileStartedEvent, RepoId: repoId, FileName: fileName, TotalBytes: totalBytes, Bytes: resumedBytes})
+}
+
+func (r *ChannelProgressReporter) BytesWritten(repoId string, fileName string, n int64) {
+	r.send(ProgressEvent{Type: BytesWrittenEvent, RepoId: repoId, FileName: fileName, Bytes: n})
+}
+
+func (r *ChannelProgressReporter) FileFinished(repoId string, fileName string) {
+	r.send(ProgressEvent{Type: FileFinishedEvent, RepoId: repoId, FileName: fileName})
+}
+
+func (r *ChannelProgressReporter) FileFailed(repoId string, fileName string, err error) {
+	r.send(ProgressEvent{Type: FileFailedEvent, RepoId: repoId, FileName: fileName, Err: err})
+}
+
+func (r *ChannelProgressReporter) FileCached(repoId string, fileName string, size int64) {
+	r.send(ProgressEvent{Type: FileCachedEvent, RepoId: repoId, FileName: fileName, Bytes: size})
+}
+
+// NoopProgressReporter discards every progress event.
+type NoopProgressReporter struct{}
+
+func (NoopProgressReporter) SnapshotStarted(repoId string, totalFiles int, totalBytes int64)      {}
+func (NoopProgressReporter) SnapshotFinished(repoId string, downloadedFiles int, failedFiles int) {}
+func (NoopProgressReporter) FileStarted(repoId string, fileName string, totalBytes int64, resumedBytes int64) {
+}
+func (NoopProgressReporter) BytesWritten(repoId string, fileName string, n int64)  {}
+func (NoopProgressReporter) FileFinished(repoId string, fileName string)           {}
+func (NoopProgressReporter) FileFailed(repoId string, fileName string, err error)  {}
+func (NoopProgressReporter) FileCached(repoId string, fileName string, size int64) {}
+
+// TerminalProgressReporter draws a progress bar per downloaded file on stderr. The bars are keyed by repo and file,
+// so that concurrent snapshots with files of the same name don't collide.
+// It doesn't draw anything when the HF_HUB_DISABLE_PROGRESS_BARS environment variable is set.
+type TerminalProgressReporter struct {
+	bars     map[string]*progressbar.ProgressBar
+	barsLock sync.Mutex
+}
+
+func NewTerminalProgressReporter() *TerminalProgressReporter {
+	return &TerminalProgressReporter{
+		bars: make(map[string]*progressbar.ProgressBar),
+	}
+}
+
+func (r *TerminalProgressReporter) SnapshotStarted(repoId string, totalFiles int, totalBytes int64) {}
+
+func (r *TerminalProgressReporter) SnapshotFinished(repoId string, downloadedFiles int, failedFiles int) {
+}
+
+func (r *TerminalProgressReporter) FileStarted(repoId string, fileName string, totalBytes int64, resumedBytes int64) {
+	if DisableProgressBars {
+		return
+	}
+
+	displayedFilename := fileName
+	if len(displayedFilename) > 40 {
+		displayedFilename = fmt.Sprintf("(…)%s", displayedFilename[len(displayedFilename)-40:])
+	}
+
+	bar := progressbar.DefaultBytes(totalBytes, displayedFilename)
+	bar.Set64(resumedBytes)
+
+	r.barsLock.Lock()
+	r.bars[repoId+"/"+fileName] = bar
+	r.barsLock.Unlock()
+}
+
+func (r *TerminalProgressReporter) BytesWritten(repoId string, fileName string, n int64) {
+	if bar := r.bar(repoId, fileName, false); bar != nil {
+		bar.Add64(n)
+	}
+}
+
+func (r *TerminalProgressReporter) FileFinished(repoId string, fileName string) {
+	if bar := r.bar(repoId, fileName, true); bar != nil {
+		bar.Finish()
+	}
+}
+
+func (r *TerminalProgressReporter) FileFailed(repoId string, fileName string, err error) {
+	if bar := r.bar(repoId, fileName, true); bar != nil {
+		bar.Exit()
+	}
+}
+
+func (r *TerminalProgressReporter) FileCached(repoId string, fileName string, size int64) {}
+
+func (r *TerminalProgressReporter) bar(repoId string, fileName string, remove bool) *progressbar.ProgressBar {
+	r.barsLock.Lock()
+	defer r.barsLock.Unlock()
+
+	key := repoId + "/" + fileName
+	bar := r.bars[key]
+	if remove {
+		delete(r.bars, key)
+	}
+	return bar
+}
+
+var defaultProgressReporter = NewTerminalProgressReporter()
+
+func (client *Client) progressReporter() ProgressReporter {
+	if client.ProgressReporter != nil {
+		return client.ProgressReporter
+	}
+	return defaultProgressReporter
+}
@@ -0,0 +1,101 @@
+package hub
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+// receivedEvents closes the channel of the reporter and returns the events it received.
+func receivedEvents(reporter *ChannelProgressReporter) []ProgressEvent {
+	close(reporter.Events)
+
+	var events []ProgressEvent
+	for event := range reporter.Events {
+		events = append(events, event)
+	}
+	return events
+}
+
+func countEvents(events []ProgressEvent, eventType ProgressEventType) int {
+	count := 0
+	for _, event := range events {
+		if event.Type == eventType {
+			count++
+		}
+	}
+	return count
+}
+
+func TestFileFailedIsReportedForEveryError(t *testing.T) {
+	server := newTestServer(t, map[string]string{"config.json": "{}"})
+
+	tests := []struct {
+		name   string
+		params *DownloadParams
+	}{
+		{"missing file", &DownloadParams{Repo: NewRepo("org/repo"), FileName: "missing.json"}},
+		{"missing file in local dir", &DownloadParams{Repo: NewRepo("org/repo"), FileName: "missing.json", LocalDir: t.TempDir()}},
+		{"missing offline file", &DownloadParams{Repo: NewRepo("org/repo"), FileName: "config.json", LocalFilesOnly: true}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			reporter := NewChannelProgressReporter(100)
+			_, err := newTestClient(t, server, reporter).Download(test.params)
+			if err == nil {
+				t.Fatal("the download should fail")
+			}
+
+			events := receivedEvents(reporter)
+			if len(events) != 1 || events[0].Type != FileFailedEvent {
+				t.Fatalf("events = %+v, want a single FileFailedEvent", events)
+			}
+			if events[0].RepoId != "org/repo" || events[0].FileName != test.params.FileName || !errors.Is(events[0].Err, err) {
+				t.Errorf("FileFailedEvent = %+v, want the file and error of the download", events[0])
+			}
+		})
+	}
+}
+
+func TestFileFailedIsReportedOnceForDownloadErrors(t *testing.T) {
+	content := "content"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Repo-Commit", testCommitHash)
+		serveTestFile(w, r, content, sha256Hex("other content"))
+	}))
+	defer server.Close()
+
+	reporter := NewChannelProgressReporter(100)
+	_, err := newTestClient(t, server, reporter).Download(&DownloadParams{Repo: NewRepo("org/repo"), FileName: "model.bin"})
+	if !errors.Is(err, ErrChecksumMismatch) {
+		t.Fatalf("err = %v, want %v", err, ErrChecksumMismatch)
+	}
+
+	events := receivedEvents(reporter)
+	if failed, finished := countEvents(events, FileFailedEvent), countEvents(events, FileFinishedEvent); failed != 1 || finished != 0 {
+		t.Errorf("got %d FileFailedEvent and %d FileFinishedEvent, want 1 and 0", failed, finished)
+	}
+}
+
+func TestChannelProgressReporterDropWhenFull(t *testing.T) {
+	server := newTestServer(t, map[string]string{"model.bin": strings.Repeat("x", 100)})
+
+	// Nobody reads the events, which would block the download without DropWhenFull
+	reporter := NewChannelProgressReporter(1).WithDropWhenFull(true)
+	path, err := newTestClient(t, server, reporter).Download(&DownloadParams{Repo: NewRepo("org/repo"), FileName: "model.bin"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Fatal(err)
+	}
+
+	events := receivedEvents(reporter)
+	if len(events) != 1 || events[0].Type != FileStartedEvent {
+		t.Errorf("events = %+v, want only the first event", events)
+	}
+}
@@ -0,0 +1,111 @@
+package hub
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// RateLimiter limits the bandwidth of the downloads sharing it to a number of bytes per second, with a token bucket
+// holding up to one second of data. Its limit can be changed with SetLimit at any time, including while downloads
+// are running. A limit of 0 means unlimited.
+type RateLimiter struct {
+	lock   sync.Mutex
+	limit  int64
+	tokens float64
+	last   time.Time
+	// changed is closed when the limit changes, to wake up the downloads waiting with the previous one
+	changed chan struct{}
+}
+
+func NewRateLimiter(bytesPerSecond int64) *RateLimiter {
+	return &RateLimiter{
+		limit:   bytesPerSecond,
+		tokens:  float64(bytesPerSecond),
+		last:    time.Now(),
+		changed: make(chan struct{}),
+	}
+}
+
+// Limit returns the current limit, in bytes per second.
+func (l *RateLimiter) Limit() int64 {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	return l.limit
+}
+
+// SetLimit changes the limit, in bytes per second, of the running and future downloads.
+func (l *RateLimiter) SetLimit(bytesPerSecond int64) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	l.refill(time.Now())
+	l.limit = bytesPerSecond
+	l.tokens = min(l.tokens, float64(bytesPerSecond))
+
+	if l.changed != nil {
+		close(l.changed)
+	}
+	l.changed = make(chan struct{})
+}
+
+// WaitN blocks until n bytes can be downloaded without exceeding the limit, or ctx is done.
+// A nil RateLimiter doesn't limit anything.
+func (l *RateLimiter) WaitN(ctx context.Context, n int) error {
+	if l == nil {
+		return nil
+	}
+
+	remaining := float64(n)
+	for remaining > 0 {
+		l.lock.Lock()
+		if l.limit <= 0 {
+			l.lock.Unlock()
+			return nil
+		}
+
+		l.refill(time.Now())
+
+		// reads bigger than the bucket are taken in several times
+		take := min(remaining, float64(l.limit))
+		if l.tokens >= take {
+			l.tokens -= take
+			remaining -= take
+			l.lock.Unlock()
+			continue
+		}
+
+		wait := time.Duration((take - l.tokens) / float64(l.limit) * float64(time.Second))
+		changed := l.changed
+		l.lock.Unlock()
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-changed:
+			timer.Stop()
+		case <-timer.C:
+		}
+	}
+
+	return nil
+}
+
+// refill adds the tokens accumulated since the last call. The lock must be held.
+func (l *RateLimiter) refill(now time.Time) {
+	if l.limit > 0 {
+		l.tokens = min(l.tokens+now.Sub(l.last).Seconds()*float64(l.limit), float64(l.limit))
+	}
+	l.last = now
+}
+
+// rateLimiter returns the limiter of a download: its own, or else the one of the client.
+func (client *Client) rateLimiter(params *DownloadParams) *RateLimiter {
+	if params.RateLimiter != nil {
+		return params.RateLimiter
+	}
+	return client.RateLimiter
+}
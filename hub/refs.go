@@ -0,0 +1,157 @@
+package hub
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// GitRefs lists the refs of a repo. Converts are the branches where the Hub stores converted files
+// (e.g. `refs/convert/parquet` for datasets), and PullRequests are only listed on request.
+type GitRefs struct {
+	Branches     []GitRefInfo `json:"branches"`
+	Converts     []GitRefInfo `json:"converts"`
+	Tags         []GitRefInfo `json:"tags"`
+	PullRequests []GitRefInfo `json:"pullRequests"`
+}
+
+// GitRefInfo is a git ref: Name can be used as a revision, Ref is the full ref (e.g. `refs/heads/main`),
+// and TargetCommit is the commit hash it points to.
+type GitRefInfo struct {
+	Name         string `json:"name"`
+	Ref          string `json:"ref"`
+	TargetCommit string `json:"targetCommit"`
+}
+
+type GitCommitInfo struct {
+	CommitId  string
+	Authors   []string
+	CreatedAt time.Time
+	Title     string
+	Message   string
+}
+
+func (info *GitCommitInfo) UnmarshalJSON(data []byte) error {
+	// The authors are objects with the user name and avatar, and the commit id is in `id`
+	var raw struct {
+		Id      string `json:"id"`
+		Authors []struct {
+			User string `json:"user"`
+		} `json:"authors"`
+		Date    time.Time `json:"date"`
+		Title   string    `json:"title"`
+		Message string    `json:"message"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+
+	info.CommitId = raw.Id
+	info.CreatedAt = raw.Date
+	info.Title = raw.Title
+	info.Message = raw.Message
+	info.Authors = make([]string, len(raw.Authors))
+	for i, author := range raw.Authors {
+		info.Authors[i] = author.User
+	}
+	return nil
+}
+
+// ListRepoRefs lists the branches, tags and converts of a repo, and its pull requests when includePullRequests is set.
+func (client *Client) ListRepoRefs(ctx context.Context, repo *Repo, includePullRequests bool) (*GitRefs, error) {
+	if _, err := validateRepoType(repo); err != nil {
+		return nil, err
+	}
+
+	refsUrl, err := formatUrl(hfRepoRefsTemplate, client.repoUrlParams(repo, ""))
+	if err != nil {
+		return nil, err
+	}
+
+	if includePullRequests {
+		refsUrl += "?include_prs=1"
+	}
+
+	refs := &GitRefs{}
+	if _, err := client.apiRequest(ctx, "GET", refsUrl, nil, nil, refs); err != nil {
+		return nil, err
+	}
+
+	return refs, nil
+}
+
+// ListRepoCommits lists the commits of repo.Revision (defaults to the main branch), from the most recent one.
+func (client *Client) ListRepoCommits(ctx context.Context, repo *Repo) *Iterator[*GitCommitInfo] {
+	if _, err := validateRepoType(repo); err != nil {
+		return &Iterator[*GitCommitInfo]{err: err}
+	}
+
+	commitsUrl, err := formatUrl(hfRepoCommitsTemplate, client.repoUrlParams(repo, ""))
+	if err != nil {
+		return &Iterator[*GitCommitInfo]{err: err}
+	}
+
+	return newIterator[*GitCommitInfo](ctx, client, commitsUrl, 0)
+}
+
+// CreateBranch creates a branch starting from repo.Revision (defaults to the main branch). When existOk is set,
+// creating a branch that already exists is not an error.
+func (client *Client) CreateBranch(ctx context.Context, repo *Repo, branch string, existOk bool) error {
+	payload := map[string]any{}
+	if repo.Revision != "" {
+		payload["startingPoint"] = repo.Revision
+	}
+
+	return client.refRequest(ctx, "POST", hfBranchTemplate, repo, branch, payload, existOk)
+}
+
+// DeleteBranch deletes a branch of the repo.
+func (client *Client) DeleteBranch(ctx context.Context, repo *Repo, branch string) error {
+	return client.refRequest(ctx, "DELETE", hfBranchTemplate, repo, branch, nil, false)
+}
+
+// CreateTag tags repo.Revision (defaults to the main branch), with an optional message. When existOk is set,
+// creating a tag that already exists is not an error.
+func (client *Client) CreateTag(ctx context.Context, repo *Repo, tag string, message string, existOk bool) error {
+	revision := repo.Revision
+	if revision == "" {
+		revision = DefaultRevision
+	}
+
+	payload := map[string]any{"tag": tag}
+	if message != "" {
+		payload["message"] = message
+	}
+
+	return client.refRequest(ctx, "POST", hfTagTemplate, repo, revision, payload, existOk)
+}
+
+// DeleteTag deletes a tag of the repo.
+func (client *Client) DeleteTag(ctx context.Context, repo *Repo, tag string) error {
+	return client.refRequest(ctx, "DELETE", hfTagTemplate, repo, tag, nil, false)
+}
+
+// refRequest sends a request to the branch or tag endpoint of a ref. A conflict is ignored when existOk is set.
+func (client *Client) refRequest(ctx context.Context, method string, urlTemplate string, repo *Repo, ref string, payload any, existOk bool) error {
+	if _, err := validateRepoType(repo); err != nil {
+		return err
+	}
+
+	params := client.repoUrlParams(repo, "")
+	params["Ref"] = url.PathEscape(ref)
+	refUrl, err := formatUrl(urlTemplate, params)
+	if err != nil {
+		return err
+	}
+
+	_, err = client.apiRequest(ctx, method, refUrl, nil, payload, nil)
+
+	var httpErr *HTTPError
+	if existOk && errors.As(err, &httpErr) && httpErr.StatusCode == http.StatusConflict {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,171 @@
+package hub
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+type CreateRepoParams struct {
+	Repo    *Repo
+	Private bool
+	// ExistOk makes CreateRepo succeed when the repo already exists, instead of returning an error.
+	ExistOk bool
+	// SpaceSdk is the SDK of a space: "gradio", "streamlit", "docker" or "static". It is required for spaces.
+	SpaceSdk string
+}
+
+// RepoSettings holds the settings to update with UpdateRepoSettings. Nil fields are left unchanged.
+type RepoSettings struct {
+	Private *bool
+	// Gated is "auto" or "manual" to gate the repo (with automatic or manual approval of access requests),
+	// or "false" to ungate it.
+	Gated *string
+}
+
+// CreateRepo creates a repo on the Hub and returns its URL. Port of `HfApi.create_repo` from the python package.
+func (client *Client) CreateRepo(ctx context.Context, params *CreateRepoParams) (string, error) {
+	repoType, err := validateRepoType(params.Repo)
+	if err != nil {
+		return "", err
+	}
+
+	if repoType == SpaceRepoType && params.SpaceSdk == "" {
+		return "", fmt.Errorf("a space SDK is required to create a space")
+	}
+
+	createUrl, err := formatUrl(hfCreateRepoTemplate, client.repoUrlParams(params.Repo, ""))
+	if err != nil {
+		return "", err
+	}
+
+	payload := repoPayload(params.Repo)
+	payload["private"] = params.Private
+	if params.SpaceSdk != "" {
+		payload["sdk"] = params.SpaceSdk
+	}
+
+	var data struct {
+		Url string `json:"url"`
+	}
+	_, err = client.apiRequest(ctx, "POST", createUrl, nil, payload, &data)
+
+	var httpErr *HTTPError
+	if params.ExistOk && errors.As(err, &httpErr) && httpErr.StatusCode == http.StatusConflict {
+		return fmt.Sprintf("%s/%s%s", client.Endpoint, RepoTypesUrlPrefixes[repoType], params.Repo.Id), nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	return data.Url, nil
+}
+
+// DeleteRepo deletes a repo from the Hub. When missingOk is set, deleting a repo that doesn't exist is not an error.
+func (client *Client) DeleteRepo(ctx context.Context, repo *Repo, missingOk bool) error {
+	if _, err := validateRepoType(repo); err != nil {
+		return err
+	}
+
+	deleteUrl, err := formatUrl(hfDeleteRepoTemplate, client.repoUrlParams(repo, ""))
+	if err != nil {
+		return err
+	}
+
+	_, err = client.apiRequest(ctx, "DELETE", deleteUrl, nil, repoPayload(repo), nil)
+
+	var httpErr *HTTPError
+	if missingOk && errors.As(err, &httpErr) && httpErr.StatusCode == http.StatusNotFound {
+		return nil
+	}
+	return err
+}
+
+// MoveRepo renames a repo, or transfers it to another user or organization. toRepoId is the new `namespace/name` of the repo.
+func (client *Client) MoveRepo(ctx context.Context, repo *Repo, toRepoId string) error {
+	repoType, err := validateRepoType(repo)
+	if err != nil {
+		return err
+	}
+
+	if len(strings.Split(toRepoId, "/")) != 2 {
+		return fmt.Errorf("invalid repo id: %s, it must be in the form `namespace/name`", toRepoId)
+	}
+
+	moveUrl, err := formatUrl(hfMoveRepoTemplate, client.repoUrlParams(repo, ""))
+	if err != nil {
+		return err
+	}
+
+	payload := map[string]any{
+		"fromRepo": repo.Id,
+		"toRepo":   toRepoId,
+		"type":     repoType,
+	}
+	_, err = client.apiRequest(ctx, "POST", moveUrl, nil, payload, nil)
+	return err
+}
+
+// UpdateRepoSettings updates the visibility and the gating of a repo.
+func (client *Client) UpdateRepoSettings(ctx context.Context, repo *Repo, settings *RepoSettings) error {
+	if _, err := validateRepoType(repo); err != nil {
+		return err
+	}
+
+	settingsUrl, err := formatUrl(hfRepoSettingsTemplate, client.repoUrlParams(repo, ""))
+	if err != nil {
+		return err
+	}
+
+	payload := map[string]any{}
+	if settings.Private != nil {
+		payload["private"] = *settings.Private
+	}
+	if settings.Gated != nil {
+		switch *settings.Gated {
+		case "auto", "manual":
+			payload["gated"] = *settings.Gated
+		case "false":
+			payload["gated"] = false
+		default:
+			return fmt.Errorf("invalid gated value: %s, it must be `auto`, `manual` or `false`", *settings.Gated)
+		}
+	}
+
+	if len(payload) == 0 {
+		return fmt.Errorf("no settings to update")
+	}
+
+	_, err = client.apiRequest(ctx, "PUT", settingsUrl, nil, payload, nil)
+	return err
+}
+
+// validateRepoType returns the type of the repo, defaulting to a model.
+func validateRepoType(repo *Repo) (string, error) {
+	repoType := repo.Type
+	if repoType == "" {
+		repoType = ModelRepoType
+	}
+
+	if !isValidRepoType(repoType) {
+		return "", fmt.Errorf("invalid repo type: %s", repoType)
+	}
+	return repoType, nil
+}
+
+// repoPayload returns the name, organization and type of the repo, as expected by the create and delete endpoints.
+func repoPayload(repo *Repo) map[string]any {
+	payload := map[string]any{"name": repo.Id}
+	if organization, name, found := strings.Cut(repo.Id, "/"); found {
+		payload["organization"] = organization
+		payload["name"] = name
+	}
+
+	// Models are the default type, which the Hub expects to be omitted
+	if repo.Type != "" && repo.Type != ModelRepoType {
+		payload["type"] = repo.Type
+	}
+	return payload
+}
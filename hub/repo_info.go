@@ -0,0 +1,176 @@
+package hub
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// RepoInfo is the info of a repo returned by Client.RepoInfo: a *ModelInfo, *DatasetInfo or *SpaceInfo.
+type RepoInfo interface {
+	RepoId() string
+	// RepoSha returns the commit hash of the revision the info describes.
+	RepoSha() string
+	RepoSiblings() []RepoSibling
+}
+
+// GatedStatus is "auto" or "manual" for gated repos (depending on how access requests are approved), or "" otherwise.
+type GatedStatus string
+
+func (g *GatedStatus) UnmarshalJSON(data []byte) error {
+	// The Hub sends `false` for repos that aren't gated
+	var gated bool
+	if err := json.Unmarshal(data, &gated); err == nil {
+		*g = ""
+		return nil
+	}
+
+	var status string
+	if err := json.Unmarshal(data, &status); err != nil {
+		return err
+	}
+	*g = GatedStatus(status)
+	return nil
+}
+
+// RepoSibling is a file of a repo. Size, BlobId and Lfs are only set by the endpoints listing the file metadata.
+type RepoSibling struct {
+	RFileName string       `json:"rfilename"`
+	Size      int64        `json:"size"`
+	BlobId    string       `json:"blobId"`
+	Lfs       *BlobLfsInfo `json:"lfs"`
+}
+
+// ModelInfoSibling is the former name of RepoSibling.
+type ModelInfoSibling = RepoSibling
+
+// BlobLfsInfo describes a file stored with LFS: Sha256 is the hash of its content, and PointerSize the size of
+// the pointer file committed in git.
+type BlobLfsInfo struct {
+	Size        int64  `json:"size"`
+	Sha256      string `json:"sha256"`
+	PointerSize int64  `json:"pointerSize"`
+}
+
+// SafeTensorsInfo counts the parameters of a model stored in the safetensors format, by dtype (e.g. "F32").
+type SafeTensorsInfo struct {
+	Parameters map[string]int64 `json:"parameters"`
+	Total      int64            `json:"total"`
+}
+
+type ModelInfo struct {
+	Id               string           `json:"id"`
+	Author           string           `json:"author"`
+	Sha              string           `json:"sha"`
+	CreatedAt        time.Time        `json:"createdAt"`
+	LastModified     time.Time        `json:"lastModified"`
+	Private          bool             `json:"private"`
+	Gated            GatedStatus      `json:"gated"`
+	Disabled         bool             `json:"disabled"`
+	Downloads        int64            `json:"downloads"`
+	DownloadsAllTime int64            `json:"downloadsAllTime"`
+	Likes            int64            `json:"likes"`
+	TrendingScore    float64          `json:"trendingScore"`
+	Tags             []string         `json:"tags"`
+	PipelineTag      string           `json:"pipeline_tag"`
+	LibraryName      string           `json:"library_name"`
+	MaskToken        string           `json:"mask_token"`
+	CardData         map[string]any   `json:"cardData"`
+	Config           map[string]any   `json:"config"`
+	TransformersInfo map[string]any   `json:"transformersInfo"`
+	SafeTensors      *SafeTensorsInfo `json:"safetensors"`
+	Siblings         []RepoSibling    `json:"siblings"`
+	// Spaces lists the ids of the spaces using the model.
+	Spaces []string `json:"spaces"`
+}
+
+type DatasetInfo struct {
+	Id               string         `json:"id"`
+	Author           string         `json:"author"`
+	Sha              string         `json:"sha"`
+	CreatedAt        time.Time      `json:"createdAt"`
+	LastModified     time.Time      `json:"lastModified"`
+	Private          bool           `json:"private"`
+	Gated            GatedStatus    `json:"gated"`
+	Disabled         bool           `json:"disabled"`
+	Downloads        int64          `json:"downloads"`
+	DownloadsAllTime int64          `json:"downloadsAllTime"`
+	Likes            int64          `json:"likes"`
+	TrendingScore    float64        `json:"trendingScore"`
+	PapersWithCodeId string         `json:"paperswithcode_id"`
+	Tags             []string       `json:"tags"`
+	CardData         map[string]any `json:"cardData"`
+	Siblings         []RepoSibling  `json:"siblings"`
+}
+
+type SpaceInfo struct {
+	Id            string         `json:"id"`
+	Author        string         `json:"author"`
+	Sha           string         `json:"sha"`
+	CreatedAt     time.Time      `json:"createdAt"`
+	LastModified  time.Time      `json:"lastModified"`
+	Private       bool           `json:"private"`
+	Gated         GatedStatus    `json:"gated"`
+	Disabled      bool           `json:"disabled"`
+	Host          string         `json:"host"`
+	Subdomain     string         `json:"subdomain"`
+	Likes         int64          `json:"likes"`
+	TrendingScore float64        `json:"trendingScore"`
+	Sdk           string         `json:"sdk"`
+	Tags          []string       `json:"tags"`
+	CardData      map[string]any `json:"cardData"`
+	// Runtime is the state of the space hardware, e.g. its stage ("RUNNING") and hardware ("cpu-basic").
+	Runtime  map[string]any `json:"runtime"`
+	Siblings []RepoSibling  `json:"siblings"`
+	// Models and Datasets list the ids of the repos used by the space.
+	Models   []string `json:"models"`
+	Datasets []string `json:"datasets"`
+}
+
+func (info *ModelInfo) RepoId() string              { return info.Id }
+func (info *ModelInfo) RepoSha() string             { return info.Sha }
+func (info *ModelInfo) RepoSiblings() []RepoSibling { return info.Siblings }
+
+func (info *DatasetInfo) RepoId() string              { return info.Id }
+func (info *DatasetInfo) RepoSha() string             { return info.Sha }
+func (info *DatasetInfo) RepoSiblings() []RepoSibling { return info.Siblings }
+
+func (info *SpaceInfo) RepoId() string              { return info.Id }
+func (info *SpaceInfo) RepoSha() string             { return info.Sha }
+func (info *SpaceInfo) RepoSiblings() []RepoSibling { return info.Siblings }
+
+// RepoInfo fetches the info of a repo at repo.Revision (or its default branch when empty), with the metadata of
+// its files. The result is a *ModelInfo, *DatasetInfo or *SpaceInfo depending on repo.Type.
+func (client *Client) RepoInfo(ctx context.Context, repo *Repo) (RepoInfo, error) {
+	var info RepoInfo
+	switch repo.Type {
+	case ModelRepoType, "":
+		info = &ModelInfo{}
+	case DatasetRepoType:
+		info = &DatasetInfo{}
+	case SpaceRepoType:
+		info = &SpaceInfo{}
+	default:
+		return nil, fmt.Errorf("invalid repo type: %s", repo.Type)
+	}
+
+	urlTemplate := hfRepoRevisionInfoTemplate
+	if repo.Revision == "" {
+		urlTemplate = hfRepoInfoTemplate
+	}
+
+	repoInfoUrl, err := formatUrl(urlTemplate, client.repoUrlParams(repo, ""))
+	if err != nil {
+		return nil, err
+	}
+	// blobs=true adds the size, blob id and LFS info of each file to the siblings
+	repoInfoUrl += "?blobs=true"
+
+	// the snapshot download falls back to the cache when offline, which must not wait for retries
+	if _, err := client.apiRequest(withoutConnectionRetries(ctx), "GET", repoInfoUrl, nil, nil, info); err != nil {
+		return nil, err
+	}
+
+	return info, nil
+}
@@ -0,0 +1,130 @@
+package hub
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
+	"net"
+	"slices"
+	"time"
+)
+
+// RetryPolicy configures how requests failing with a network error or a transient status are retried, as well
+// as downloads interrupted mid-stream, which are resumed where they stopped. The wait between two attempts grows
+// exponentially from InitialBackoff up to MaxBackoff, unless the server tells how long to wait with Retry-After.
+type RetryPolicy struct {
+	// MaxRetries is the number of retries after a failed attempt. For downloads, it is the number of consecutive
+	// retries without receiving any data.
+	MaxRetries     int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	// Jitter randomizes each wait by up to this fraction of it (between 0 and 1), so that concurrent
+	// downloads don't retry all at once.
+	Jitter float64
+	// RetryStatusCodes are the error statuses that are retried.
+	RetryStatusCodes []int
+}
+
+// DefaultRetryPolicy is used by clients without a RetryPolicy. Its backoff matches the python package.
+var DefaultRetryPolicy = RetryPolicy{
+	MaxRetries:       DefaultRetries,
+	InitialBackoff:   1 * time.Second,
+	MaxBackoff:       8 * time.Second,
+	Jitter:           0.2,
+	RetryStatusCodes: []int{429, 500, 502, 503, 504},
+}
+
+func (client *Client) retryPolicy() *RetryPolicy {
+	if client.RetryPolicy != nil {
+		return client.RetryPolicy
+	}
+	return &DefaultRetryPolicy
+}
+
+// retry waits before retrying an attempt that failed with err, after the given number of consecutive failures.
+// It returns err when it isn't retryable or there are no retries left, or ctx.Err() if ctx is done while waiting.
+func (policy *RetryPolicy) retry(ctx context.Context, failures int, err error, description string) error {
+	if !policy.isRetryable(err) {
+		return err
+	}
+
+	if failures >= policy.MaxRetries {
+		if policy.MaxRetries == 0 {
+			return err
+		}
+		return fmt.Errorf("%w (max retries exceeded)", err)
+	}
+
+	wait := policy.backoff(failures)
+	var httpErr *HTTPError
+	if errors.As(err, &httpErr) && httpErr.RetryAfter > 0 {
+		wait = httpErr.RetryAfter
+	}
+
+	log.Printf("%s failed: %s. Retrying in %s (%d/%d)\n", description, err, wait.Round(time.Millisecond), failures+1, policy.MaxRetries)
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(wait):
+		return nil
+	}
+}
+
+// backoff returns the wait before the next attempt, after the given number of consecutive failures.
+func (policy *RetryPolicy) backoff(failures int) time.Duration {
+	wait := policy.InitialBackoff
+	for i := 0; i < failures && wait < policy.MaxBackoff; i++ {
+		wait *= 2
+	}
+	if policy.MaxBackoff > 0 {
+		wait = min(wait, policy.MaxBackoff)
+	}
+
+	if policy.Jitter > 0 {
+		wait += time.Duration((rand.Float64()*2 - 1) * policy.Jitter * float64(wait))
+	}
+	return wait
+}
+
+func (policy *RetryPolicy) isRetryableStatus(statusCode int) bool {
+	return statusCode >= 400 && slices.Contains(policy.RetryStatusCodes, statusCode)
+}
+
+// isRetryable reports whether an error is transient: a retryable status, a network failure or a connection
+// closed in the middle of a response.
+func (policy *RetryPolicy) isRetryable(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+
+	var httpErr *HTTPError
+	if errors.As(err, &httpErr) {
+		return policy.isRetryableStatus(httpErr.StatusCode)
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+
+	return isOfflineError(err) || errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+type noConnectionRetriesKey struct{}
+
+// withoutConnectionRetries marks the requests made with ctx to fail right away when the Hub can't be reached, like
+// the metadata calls, whose callers fall back to the cache when offline rather than waiting for the retries.
+func withoutConnectionRetries(ctx context.Context) context.Context {
+	return context.WithValue(ctx, noConnectionRetriesKey{}, true)
+}
+
+// isConnectionError reports whether a request failed before reaching the server: a DNS failure, or a connection
+// refused or timing out.
+func isConnectionError(err error) bool {
+	var netOpErr *net.OpError
+	var dnsErr *net.DNSError
+	return (errors.As(err, &netOpErr) && netOpErr.Op == "dial") || errors.As(err, &dnsErr)
+}
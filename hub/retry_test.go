@@ -0,0 +1,153 @@
+package hub
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+var testRetryPolicy = &RetryPolicy{
+	MaxRetries:       2,
+	InitialBackoff:   time.Millisecond,
+	MaxBackoff:       5 * time.Millisecond,
+	RetryStatusCodes: DefaultRetryPolicy.RetryStatusCodes,
+}
+
+// truncatedResponseWriter sends at most limit bytes of the response body, after which the connection is closed
+// since the response is shorter than its Content-Length.
+type truncatedResponseWriter struct {
+	http.ResponseWriter
+	limit int
+}
+
+func (w *truncatedResponseWriter) Write(p []byte) (int, error) {
+	p = p[:min(len(p), w.limit)]
+	w.limit -= len(p)
+	return w.ResponseWriter.Write(p)
+}
+
+func TestRequestRetries(t *testing.T) {
+	tests := []struct {
+		name         string
+		statuses     []int
+		wantAttempts int
+		wantStatus   int
+	}{
+		{"transient statuses", []int{429, 503, 200}, 3, 200},
+		{"max retries exceeded", []int{500, 502, 504, 200}, 3, 504},
+		{"not retryable status", []int{404, 200}, 1, 404},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var attempts atomic.Int64
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(test.statuses[attempts.Add(1)-1])
+			}))
+			defer server.Close()
+
+			client := newTestClient(t, server, nil).WithRetryPolicy(testRetryPolicy)
+			response, err := client.requestWrapper(context.Background(), "GET", server.URL, true, true, &http.Header{}, nil)
+
+			status := 0
+			var httpErr *HTTPError
+			if errors.As(err, &httpErr) {
+				status = httpErr.StatusCode
+			} else if err != nil {
+				t.Fatal(err)
+			} else {
+				status = response.StatusCode
+				response.Body.Close()
+			}
+
+			if status != test.wantStatus {
+				t.Errorf("status = %d, want %d", status, test.wantStatus)
+			}
+			if int(attempts.Load()) != test.wantAttempts {
+				t.Errorf("%d attempts, want %d", attempts.Load(), test.wantAttempts)
+			}
+		})
+	}
+}
+
+func TestRequestRetriesHonorRetryAfter(t *testing.T) {
+	var attempts atomic.Int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if attempts.Add(1) == 1 {
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusTooManyRequests)
+		}
+	}))
+	defer server.Close()
+
+	client := newTestClient(t, server, nil).WithRetryPolicy(testRetryPolicy)
+	start := time.Now()
+	response, err := client.requestWrapper(context.Background(), "GET", server.URL, true, true, &http.Header{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+
+	if elapsed := time.Since(start); elapsed < time.Second {
+		t.Errorf("retried after %s, want the second of Retry-After", elapsed)
+	}
+}
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	policy := &RetryPolicy{InitialBackoff: 10 * time.Millisecond, MaxBackoff: 30 * time.Millisecond}
+
+	for failures, want := range []time.Duration{10 * time.Millisecond, 20 * time.Millisecond, 30 * time.Millisecond, 30 * time.Millisecond} {
+		if got := policy.backoff(failures); got != want {
+			t.Errorf("backoff(%d) = %s, want %s", failures, got, want)
+		}
+	}
+}
+
+func TestDownloadRetriesResetOnProgress(t *testing.T) {
+	content := strings.Repeat("0123456789", 5)
+
+	var requests atomic.Int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		// Every response is cut after 10 bytes, which takes more attempts than MaxRetries, but each makes progress
+		serveTestFile(&truncatedResponseWriter{w, 10}, r, content, sha256Hex(content))
+	}))
+	defer server.Close()
+
+	client := newTestClient(t, server, nil).WithRetryPolicy(&RetryPolicy{MaxRetries: 1, InitialBackoff: time.Millisecond})
+	path, err := downloadTestFile(t, client, server.URL, len(content), sha256Hex(content))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assertFileContent(t, path, content)
+	if requests.Load() != 5 {
+		t.Errorf("%d requests were sent, want 5 resumed from the current offset", requests.Load())
+	}
+}
+
+func TestDownloadRetriesStopWithoutProgress(t *testing.T) {
+	content := strings.Repeat("0123456789", 5)
+
+	var requests atomic.Int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+	}))
+	defer server.Close()
+
+	client := newTestClient(t, server, nil).WithRetryPolicy(&RetryPolicy{MaxRetries: 2, InitialBackoff: time.Millisecond})
+	if _, err := downloadTestFile(t, client, server.URL, len(content), sha256Hex(content)); err == nil {
+		t.Fatal("the download should fail")
+	}
+
+	if requests.Load() != 3 {
+		t.Errorf("%d requests were sent, want 3", requests.Load())
+	}
+}
@@ -1,28 +1,30 @@
 package hub
 
 import (
-	"encoding/json"
+	"context"
 	"errors"
 	"fmt"
-	"net/http"
+	"log"
 	"os"
 	"path/filepath"
 	"regexp"
+	"strings"
 	"sync"
+	"sync/atomic"
 )
 
-func snapshotDownload(client *Client, params *DownloadParams) (string, error) {
+func snapshotDownload(ctx context.Context, client *Client, params *DownloadParams) (string, error) {
 	repo := params.Repo
 	localFilesOnly := params.LocalFilesOnly
 
 	wg := sync.WaitGroup{}
 	var (
-		modelInfo *ModelInfo
-		err       error
+		repoInfo RepoInfo
+		err      error
 	)
 
-	if !localFilesOnly {
-		modelInfo, err = client.getModelInfo(repo)
+	if !localFilesOnly && !IsOffline {
+		repoInfo, err = client.RepoInfo(ctx, repo)
 		if err != nil && !isOfflineError(err) {
 			return "", err
 		}
@@ -31,27 +33,23 @@ func snapshotDownload(client *Client, params *DownloadParams) (string, error) {
 	storageFolder := filepath.Join(client.CacheDir, repoFolderName(repo.Id, repo.Type))
 	var commitHash string
 
-	// modelInfo == nil means localFilesOnly is set to true or we're offline, so we cannot download the model.
+	// repoInfo == nil means localFilesOnly is set to true or we're offline, so we cannot download the repo.
 	// instead, we'll try to get the commit hash, and reolve a cached snapshot of the repo.
 	// if we can't find it, we'll return an error.
-	if modelInfo == nil {
+	if repoInfo == nil {
 		if regexp.MustCompile(CommitHashPattern).MatchString(repo.Revision) {
 			commitHash = repo.Revision
 		} else {
 			refPath := filepath.Join(storageFolder, "refs", repo.Revision)
-			_, err := os.Stat(refPath)
+			content, err := os.ReadFile(refPath)
 			if err == nil {
-				content, err := os.ReadFile(refPath)
-				if err != nil {
-					return "", err
-				}
 				commitHash = string(content)
-			} else {
+			} else if !errors.Is(err, os.ErrNotExist) {
 				return "", err
 			}
 		}
 
-		if commitHash != "" {
+		if commitHash != "" && params.LocalDir == "" {
 			snapshotFolder := filepath.Join(storageFolder, "snapshots", commitHash)
 			_, err := os.Stat(snapshotFolder)
 			if err == nil {
@@ -61,108 +59,201 @@ func snapshotDownload(client *Client, params *DownloadParams) (string, error) {
 				return "", err
 			}
 		}
-	}
 
-	// we're using localFilesOnly and we cannot find a cached snapshot folder for the specified revision. so we return an error.
-	if localFilesOnly {
-		return "", fmt.Errorf(
-			"cannot find an appropriate cached snapshot folder for the specified revision on the local disk and outgoing traffic has been disabled. To enable repo look-ups and downloads online, set localFilesOnly to false",
-		)
+		// the files of a local directory download can't be checked, but we assume they're the ones wanted
+		if params.LocalDir != "" {
+			localDir, err := expandPath(params.LocalDir)
+			if err != nil {
+				return "", err
+			}
+
+			if entries, err := os.ReadDir(localDir); err == nil && len(entries) > 0 {
+				log.Printf("couldn't reach the Hub to check the files of %s, using the local directory %s\n", repo.Id, localDir)
+				return localDir, nil
+			}
+		}
+
+		// we cannot find a cached snapshot folder for the specified revision. so we return an error.
+		if localFilesOnly || IsOffline {
+			return "", &LocalEntryNotFoundError{
+				Message: "cannot find an appropriate cached snapshot folder for the specified revision on the local disk and outgoing traffic has been disabled. To enable repo look-ups and downloads online, set localFilesOnly to false and unset HF_HUB_OFFLINE",
+			}
+		}
+
+		return "", &LocalEntryNotFoundError{
+			Message: "an error happened while trying to locate the files on the Hub and we cannot find the appropriate snapshot folder for the specified revision on the local disk. Please check your internet connection and try again",
+			Err:     err,
+		}
 	}
 
-	if modelInfo.Sha == "" {
-		return "", fmt.Errorf("no sha found for this model")
+	if repoInfo.RepoSha() == "" {
+		return "", fmt.Errorf("no sha found for this repo")
 	}
 
-	if modelInfo.Siblings == nil {
-		return "", fmt.Errorf("no siblings found for this model")
+	if repoInfo.RepoSiblings() == nil {
+		return "", fmt.Errorf("no siblings found for this repo")
 	}
 
-	commitHash = modelInfo.Sha
+	commitHash = repoInfo.RepoSha()
 	snapshotFolder := filepath.Join(storageFolder, "snapshots", commitHash)
 
-	if repo.Revision != commitHash {
-		refPath := filepath.Join(storageFolder, "refs", repo.Revision)
-		_, err = os.Stat(refPath)
-		if err == nil {
-			err := os.WriteFile(refPath, []byte(commitHash), os.ModePerm)
-			if err != nil {
-				return "", err
-			}
-		} else if !errors.Is(err, os.ErrNotExist) {
+	siblings := repoInfo.RepoSiblings()
+	fileNames := make([]string, len(siblings))
+	fileSizes := make(map[string]int64, len(siblings))
+	for i, sibling := range siblings {
+		fileNames[i] = sibling.RFileName
+		fileSizes[sibling.RFileName] = sibling.Size
+	}
+	fileNames = filterRepoFiles(fileNames, params.AllowPatterns, params.IgnorePatterns)
+
+	maxWorkers := params.MaxWorkers
+	if maxWorkers <= 0 {
+		maxWorkers = client.MaxWorkers
+	}
+	if maxWorkers <= 0 {
+		maxWorkers = DefaultMaxWorkers
+	}
+
+	// downloadCtx is cancelled on the first failure when params.FailFast is set
+	downloadCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var totalBytes, missingBytes int64
+	for _, fileName := range fileNames {
+		totalBytes += fileSizes[fileName]
+		if _, err := os.Stat(filepath.Join(snapshotFolder, fileName)); err != nil {
+			missingBytes += fileSizes[fileName]
+		}
+	}
+
+	if params.LocalDir == "" {
+		// the cache is pruned once for the whole snapshot, rather than by each file download, and before the ref is
+		// written so that the revision isn't evicted
+		client.makeRoomInCache(missingBytes, &cachedRevisionKey{filepath.Base(storageFolder), commitHash})
+
+		// Store the ref, so that the snapshot can be resolved offline later on
+		err = cacheCommitHashForSpecificRevision(storageFolder, repo.Revision, commitHash)
+		if err != nil {
 			return "", err
 		}
 	}
 
+	progress := client.progressReporter()
+	progress.SnapshotStarted(repo.Id, len(fileNames), totalBytes)
+
+	var (
+		failedLock sync.Mutex
+		failed     []*FileDownloadError
+		downloaded atomic.Int64
+	)
+
 	download := func(fileName string) {
-		wg.Add(1)
-		defer wg.Done()
 		fileParams := &DownloadParams{
-			Repo:           repo,
-			FileName:       fileName,
-			Revision:       params.Revision,
+			Repo:     repo,
+			FileName: fileName,
+			// pin the files to the commit of the snapshot, even if the branch moves during the download
+			Revision:       commitHash,
 			ForceDownload:  params.ForceDownload,
 			LocalFilesOnly: params.LocalFilesOnly,
+			LocalDir:       params.LocalDir,
+			RateLimiter:    client.rateLimiter(params),
+		}
+
+		_, err := fileDownload(downloadCtx, client, fileParams, false)
+		if err == nil {
+			downloaded.Add(1)
+			return
 		}
 
-		fileDownload(client, fileParams)
+		// other downloads aborted because of a fail-fast cancellation are not failures on their own
+		if errors.Is(err, context.Canceled) && downloadCtx.Err() != nil && ctx.Err() == nil {
+			return
+		}
+
+		failedLock.Lock()
+		failed = append(failed, &FileDownloadError{FileName: fileName, Err: err})
+		failedLock.Unlock()
+
+		if params.FailFast {
+			cancel()
+		}
 	}
 
-	for _, sibling := range modelInfo.Siblings {
-		go download(sibling.RFileName)
+	fileNamesChan := make(chan string)
+	for i := 0; i < min(maxWorkers, len(fileNames)); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for fileName := range fileNamesChan {
+				download(fileName)
+			}
+		}()
 	}
 
+sendLoop:
+	for _, fileName := range fileNames {
+		select {
+		case fileNamesChan <- fileName:
+		case <-downloadCtx.Done():
+			break sendLoop
+		}
+	}
+	close(fileNamesChan)
+
 	wg.Wait()
+	progress.SnapshotFinished(repo.Id, int(downloaded.Load()), len(failed))
+
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+
+	if len(failed) > 0 {
+		return "", &SnapshotDownloadError{RepoId: repo.Id, Failed: failed}
+	}
+
+	if params.LocalDir != "" {
+		return expandPath(params.LocalDir)
+	}
+
 	return snapshotFolder, nil
 }
 
-func (c *Client) getModelInfo(repo *Repo) (*ModelInfo, error) {
-	headers := &http.Header{}
-	headers.Set("User-Agent", DefaultUserAgent)
+// FileDownloadError describes why a single file of a snapshot could not be downloaded.
+type FileDownloadError struct {
+	FileName string
+	Err      error
+}
 
-	if repo.Type != ModelRepoType {
-		return nil, fmt.Errorf("invalid repo type: %s", repo.Type)
-	}
+func (e *FileDownloadError) Error() string {
+	return fmt.Sprintf("%s: %s", e.FileName, e.Err)
+}
 
-	var (
-		modelInfoUrl string
-		err          error
-	)
+func (e *FileDownloadError) Unwrap() error {
+	return e.Err
+}
 
-	if repo.Revision != "" {
-		modelInfoUrl, err = formatUrl(
-			hfModelRevisionInfoTemplate,
-			map[string]string{
-				"Endpoint": c.Endpoint,
-				"RepoId":   repo.Id,
-				"Revision": repo.Revision,
-			},
-		)
-	} else {
-		modelInfoUrl, err = formatUrl(
-			hfModelRevisionInfoTemplate,
-			map[string]string{
-				"Endpoint": c.Endpoint,
-				"RepoId":   repo.Id,
-			},
-		)
-	}
+// SnapshotDownloadError is returned by a snapshot download when at least one of its files failed.
+// It wraps every FileDownloadError, so errors.Is and errors.As look through all of them.
+type SnapshotDownloadError struct {
+	RepoId string
+	Failed []*FileDownloadError
+}
 
-	if err != nil {
-		return nil, err
+func (e *SnapshotDownloadError) Error() string {
+	var message strings.Builder
+	fmt.Fprintf(&message, "failed to download %d file(s) of %s:", len(e.Failed), e.RepoId)
+	for _, failure := range e.Failed {
+		fmt.Fprintf(&message, "\n  - %s", failure)
 	}
 
-	response, err := requestWrapper("GET", modelInfoUrl, false, true, headers)
-	if err != nil {
-		return nil, err
-	}
-	defer response.Body.Close()
+	return message.String()
+}
 
-	var data = &ModelInfo{}
-	err = json.NewDecoder(response.Body).Decode(&data)
-	if err != nil {
-		return nil, err
+func (e *SnapshotDownloadError) Unwrap() []error {
+	errs := make([]error, len(e.Failed))
+	for i, failure := range e.Failed {
+		errs[i] = failure
 	}
 
-	return data, nil
+	return errs
 }
@@ -0,0 +1,144 @@
+package hub
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const defaultHfHome = "~/.cache/huggingface"
+
+// GetToken returns the token used to authenticate to the Hub, looked up in the same order as the python package:
+// the HF_TOKEN and HUGGING_FACE_HUB_TOKEN environment variables, then the token file written by
+// `huggingface-cli login` ($HF_TOKEN_PATH, defaulting to $HF_HOME/token). It returns "" when no token is found.
+func GetToken() string {
+	for _, envName := range []string{"HF_TOKEN", "HUGGING_FACE_HUB_TOKEN"} {
+		if token := strings.TrimSpace(os.Getenv(envName)); token != "" {
+			return token
+		}
+	}
+
+	tokenPath, err := expandPath(tokenPath())
+	if err != nil {
+		return ""
+	}
+
+	content, err := os.ReadFile(tokenPath)
+	if err != nil {
+		return ""
+	}
+
+	return strings.TrimSpace(string(content))
+}
+
+// GetStoredTokens returns the tokens saved by `huggingface-cli login`, by name.
+// They are read from $HF_STORED_TOKENS_PATH, defaulting to $HF_HOME/stored_tokens.
+func GetStoredTokens() (map[string]string, error) {
+	storedTokensPath, err := expandPath(storedTokensPath())
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := os.Open(storedTokensPath)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return map[string]string{}, nil
+		}
+		return nil, err
+	}
+	defer file.Close()
+
+	// The file is in the INI format, with a section per token name and the token in its `hf_token` key
+	tokens := make(map[string]string)
+	section := ""
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") {
+			continue
+		}
+
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			section = strings.TrimSpace(line[1 : len(line)-1])
+			continue
+		}
+
+		key, value, found := strings.Cut(line, "=")
+		if !found {
+			key, value, found = strings.Cut(line, ":")
+		}
+		if found && section != "" && strings.TrimSpace(key) == "hf_token" {
+			tokens[section] = strings.TrimSpace(value)
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return tokens, nil
+}
+
+// GetStoredToken returns the stored token with the given name, to be used with Client.WithToken.
+func GetStoredToken(name string) (string, error) {
+	tokens, err := GetStoredTokens()
+	if err != nil {
+		return "", err
+	}
+
+	token, ok := tokens[name]
+	if !ok {
+		return "", fmt.Errorf("no stored token named %s", name)
+	}
+	return token, nil
+}
+
+// GetActiveTokenName returns the name of the stored token currently in use (see GetToken),
+// or "" if it isn't one of the stored tokens.
+func GetActiveTokenName() string {
+	token := GetToken()
+	if token == "" {
+		return ""
+	}
+
+	tokens, err := GetStoredTokens()
+	if err != nil {
+		return ""
+	}
+
+	for name, storedToken := range tokens {
+		if storedToken == token {
+			return name
+		}
+	}
+	return ""
+}
+
+func hfHome() string {
+	if hfHome := os.Getenv("HF_HOME"); hfHome != "" {
+		return hfHome
+	}
+
+	if xdgCacheHome := os.Getenv("XDG_CACHE_HOME"); xdgCacheHome != "" {
+		return filepath.Join(xdgCacheHome, "huggingface")
+	}
+
+	return defaultHfHome
+}
+
+func tokenPath() string {
+	if tokenPath := os.Getenv("HF_TOKEN_PATH"); tokenPath != "" {
+		return tokenPath
+	}
+	return filepath.Join(hfHome(), "token")
+}
+
+func storedTokensPath() string {
+	if storedTokensPath := os.Getenv("HF_STORED_TOKENS_PATH"); storedTokensPath != "" {
+		return storedTokensPath
+	}
+	return filepath.Join(hfHome(), "stored_tokens")
+}
@@ -6,6 +6,9 @@ import (
 	"errors"
 	"os"
 	"syscall"
+	"time"
+
+	"golang.org/x/sys/unix"
 )
 
 func CreateSymlink(src string, dst string) error {
@@ -35,3 +38,13 @@ func GetAvailableDiskSpace(path string) (uint64, error) {
 
 	return stat.Bavail * uint64(stat.Bsize), nil
 }
+
+func GetAccessTime(path string) (time.Time, error) {
+	var stat unix.Stat_t
+	err := unix.Stat(path, &stat)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	return time.Unix(stat.Atim.Unix()), nil
+}
@@ -4,7 +4,10 @@ package utils
 
 import (
 	"errors"
+	"fmt"
 	"os"
+	"syscall"
+	"time"
 
 	"golang.org/x/sys/windows"
 )
@@ -40,3 +43,17 @@ func GetAvailableDiskSpace(path string) (uint64, error) {
 	}
 	return freeBytesAvailable, nil
 }
+
+func GetAccessTime(path string) (time.Time, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	attributes, ok := info.Sys().(*syscall.Win32FileAttributeData)
+	if !ok {
+		return time.Time{}, fmt.Errorf("unexpected file attributes for %s", path)
+	}
+
+	return time.Unix(0, attributes.LastAccessTime.Nanoseconds()), nil
+}